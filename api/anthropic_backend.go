@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"terminal-claude/config"
+	"terminal-claude/models"
+)
+
+// AnthropicBackend sends requests to the Anthropic Messages API
+type AnthropicBackend struct {
+	APIKey  string
+	BaseURL string // defaults to config.DefaultAnthropicBaseURL
+
+	// HTTPClient sends the requests; nil means http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// anthropicURL joins an API path to a base URL, defaulting to the real API
+func anthropicURL(baseURL string, path string) string {
+	if baseURL == "" {
+		baseURL = config.DefaultAnthropicBaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/") + path
+}
+
+// httpClientOrDefault returns client, or http.DefaultClient if it is nil
+func httpClientOrDefault(client *http.Client) *http.Client {
+	if client == nil {
+		return http.DefaultClient
+	}
+	return client
+}
+
+// setAnthropicHeaders adds the authentication and version headers every
+// Anthropic API request needs
+func setAnthropicHeaders(req *http.Request, apiKey string) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+}
+
+// Complete makes a single attempt at a Messages request
+func (b *AnthropicBackend) Complete(ctx context.Context, requestBody models.AnthropicRequest, onDelta StreamFunc) (*models.AnthropicResponse, error) {
+	requestBody.Stream = onDelta != nil
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", anthropicURL(b.BaseURL, "/v1/messages"), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %v", err)
+	}
+
+	setAnthropicHeaders(req, b.APIKey)
+	// Use a newer API version
+	req.Header.Set("anthropic-beta", "messages-2023-12-15")
+
+	if requestBody.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := httpClientOrDefault(b.HTTPClient).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to Claude: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp, bodyBytes)
+	}
+
+	if requestBody.Stream {
+		result, err := readStream(resp.Body, onDelta)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			apiErr.RequestID = resp.Header.Get("request-id")
+		}
+		return result, err
+	}
+
+	var result models.AnthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,243 @@
+// Package apitest provides a deterministic, scripted stand-in for the Claude
+// API so that handlers can be exercised without network access.
+package apitest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"terminal-claude/api"
+)
+
+// ErrScriptExhausted is returned when a Fake is asked for more replies than
+// its script holds
+var ErrScriptExhausted = errors.New("apitest: no scripted replies left")
+
+// Reply is one scripted response from the model
+type Reply struct {
+	// Text is the response text, streamed a word at a time when requested
+	Text string
+
+	// Thinking is reasoning reported alongside the text
+	Thinking string
+
+	// ToolCalls are run through the request's RunTool before the next reply
+	// in the script is used, as a real model would wait for their results
+	ToolCalls []ToolCall
+
+	// Truncated marks the final reply as cut off by the token limit
+	Truncated bool
+
+	// Data answers an Extract call. It is encoded as JSON and must match the
+	// request's schema.
+	Data interface{}
+
+	// Err, when set, is returned instead of a response
+	Err error
+}
+
+// ToolCall is a scripted request to use a tool
+type ToolCall struct {
+	Name  string
+	Input map[string]interface{}
+}
+
+// ToolResult records the outcome of a scripted tool call
+type ToolResult struct {
+	Name   string
+	Output string
+	Err    error
+}
+
+// Fake is an api.LLM that answers from a script, recording what it was sent
+type Fake struct {
+	mutex       sync.Mutex
+	replies     []Reply
+	requests    []api.ChatRequest
+	extractions []api.ExtractRequest
+	toolResults []ToolResult
+}
+
+// NewFake creates a fake that gives the replies in order
+func NewFake(replies ...Reply) *Fake {
+	return &Fake{replies: replies}
+}
+
+// Script appends more replies to the end of the script
+func (f *Fake) Script(replies ...Reply) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.replies = append(f.replies, replies...)
+}
+
+// Send answers with the next scripted replies
+func (f *Fake) Send(ctx context.Context, chat api.ChatRequest) (*api.Response, error) {
+	f.mutex.Lock()
+	f.requests = append(f.requests, chat)
+	f.mutex.Unlock()
+
+	response := &api.Response{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		reply, err := f.next()
+		if err != nil {
+			return nil, err
+		}
+		if reply.Err != nil {
+			return nil, reply.Err
+		}
+
+		if reply.Text != "" {
+			if response.Text != "" {
+				response.Text += "\n\n"
+				stream(chat.OnDelta, "\n\n")
+			}
+			response.Text += reply.Text
+			stream(chat.OnDelta, reply.Text)
+		}
+
+		if reply.Thinking != "" {
+			if response.Thinking != "" {
+				response.Thinking += "\n\n"
+			}
+			response.Thinking += reply.Thinking
+		}
+
+		if len(reply.ToolCalls) == 0 {
+			response.StopReason = "end_turn"
+			if reply.Truncated {
+				response.StopReason = "max_tokens"
+				response.Truncated = true
+			}
+			break
+		}
+		for _, call := range reply.ToolCalls {
+			f.runTool(ctx, chat, call)
+		}
+	}
+
+	if chat.Conversation != nil && response.Text != "" {
+		chat.Conversation.Record(chat.Prompt, response.Text)
+	}
+	return response, nil
+}
+
+// Extract answers with the Data of the next scripted reply, validated and
+// decoded the same way as a real response
+func (f *Fake) Extract(ctx context.Context, req api.ExtractRequest, out interface{}) error {
+	f.mutex.Lock()
+	f.extractions = append(f.extractions, req)
+	f.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	reply, err := f.next()
+	if err != nil {
+		return err
+	}
+	if reply.Err != nil {
+		return reply.Err
+	}
+
+	schema := req.Schema
+	if schema == nil {
+		if schema, err = api.SchemaFor(out); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(reply.Data)
+	if err != nil {
+		return err
+	}
+	return api.DecodeStructured(schema, data, out)
+}
+
+// Extractions returns every Extract request the fake has been sent
+func (f *Fake) Extractions() []api.ExtractRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]api.ExtractRequest(nil), f.extractions...)
+}
+
+// Requests returns every request the fake has been sent
+func (f *Fake) Requests() []api.ChatRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]api.ChatRequest(nil), f.requests...)
+}
+
+// Prompts returns the prompt of every request the fake has been sent
+func (f *Fake) Prompts() []string {
+	var prompts []string
+	for _, request := range f.Requests() {
+		prompts = append(prompts, request.Prompt)
+	}
+	return prompts
+}
+
+// ToolResults returns the outcome of every scripted tool call
+func (f *Fake) ToolResults() []ToolResult {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]ToolResult(nil), f.toolResults...)
+}
+
+// Remaining returns how many scripted replies have not been used yet
+func (f *Fake) Remaining() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.replies)
+}
+
+// next takes the next reply from the script
+func (f *Fake) next() (Reply, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.replies) == 0 {
+		return Reply{}, ErrScriptExhausted
+	}
+	reply := f.replies[0]
+	f.replies = f.replies[1:]
+	return reply, nil
+}
+
+// runTool executes a scripted tool call and records its outcome
+func (f *Fake) runTool(ctx context.Context, chat api.ChatRequest, call ToolCall) {
+	result := ToolResult{Name: call.Name}
+
+	input, err := json.Marshal(call.Input)
+	switch {
+	case err != nil:
+		result.Err = err
+	case chat.RunTool == nil:
+		result.Err = errors.New("apitest: request offered no tools")
+	default:
+		result.Output, result.Err = chat.RunTool(ctx, call.Name, input)
+	}
+
+	f.mutex.Lock()
+	f.toolResults = append(f.toolResults, result)
+	f.mutex.Unlock()
+}
+
+// stream passes text to onDelta a word at a time
+func stream(onDelta api.StreamFunc, text string) {
+	if onDelta == nil {
+		return
+	}
+	for _, word := range strings.SplitAfter(text, " ") {
+		if word != "" {
+			onDelta(word)
+		}
+	}
+}
+
+var _ api.LLM = (*Fake)(nil)
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"terminal-claude/models"
+)
+
+// Upload limits for attachments. Images are limited by the API itself;
+// documents are kept small enough that their base64 encoding fits within
+// the 32 MB request limit.
+const (
+	maxImageSize    = 5 * 1024 * 1024
+	maxDocumentSize = 24 * 1024 * 1024
+)
+
+// attachmentTypes maps the media types that can be attached to the content
+// block type they are sent as
+var attachmentTypes = map[string]string{
+	"image/jpeg":      "image",
+	"image/png":       "image",
+	"image/gif":       "image",
+	"image/webp":      "image",
+	"application/pdf": "document",
+}
+
+// LoadAttachment reads a local image or PDF into a content block that can be
+// sent along with a prompt. The media type is sniffed from the file contents
+// rather than trusted from its extension, and files over the upload limits
+// are refused before anything is sent.
+func LoadAttachment(path string) (models.MessageContent, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return models.MessageContent{}, fmt.Errorf("unable to read attachment: %v", err)
+	}
+	if info.IsDir() {
+		return models.MessageContent{}, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxDocumentSize {
+		return models.MessageContent{}, fmt.Errorf("%s is %s, over the %s limit for attachments",
+			filepath.Base(path), FormatSize(info.Size()), FormatSize(maxDocumentSize))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return models.MessageContent{}, fmt.Errorf("unable to read attachment: %v", err)
+	}
+
+	mediaType := http.DetectContentType(data)
+	blockType, ok := attachmentTypes[mediaType]
+	if !ok {
+		return models.MessageContent{}, fmt.Errorf("%s looks like %s; only JPEG, PNG, GIF and WebP images and PDF documents can be attached",
+			filepath.Base(path), mediaType)
+	}
+	if blockType == "image" && len(data) > maxImageSize {
+		return models.MessageContent{}, fmt.Errorf("%s is %s, over the %s limit for images",
+			filepath.Base(path), FormatSize(int64(len(data))), FormatSize(maxImageSize))
+	}
+
+	block := models.MessageContent{
+		Type: blockType,
+		Source: &models.ContentSource{
+			Type:      "base64",
+			MediaType: mediaType,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		},
+	}
+	if blockType == "document" {
+		block.Title = filepath.Base(path)
+	}
+	return block, nil
+}
+
+// FormatSize formats a size in bytes for messages
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d bytes", size)
+	}
+}
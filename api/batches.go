@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"terminal-claude/config"
+	"terminal-claude/models"
+	"time"
+)
+
+// batchTimeout bounds a single request to the Message Batches API
+const batchTimeout = time.Minute
+
+// Batch processing statuses
+const (
+	BatchInProgress = "in_progress"
+	BatchCanceling  = "canceling"
+	BatchEnded      = "ended"
+)
+
+// batchIDPattern is what the API accepts as a custom_id
+var batchIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// BatchRequest is one prompt in a Message Batch. CustomID identifies its
+// result, which may come back in any order.
+type BatchRequest struct {
+	CustomID string                  `json:"custom_id"`
+	Params   models.AnthropicRequest `json:"params"`
+}
+
+// Batch is a Message Batch as reported by the API
+type Batch struct {
+	ID               string      `json:"id"`
+	ProcessingStatus string      `json:"processing_status"`
+	RequestCounts    BatchCounts `json:"request_counts"`
+	CreatedAt        time.Time   `json:"created_at"`
+	EndedAt          *time.Time  `json:"ended_at"`
+	ExpiresAt        time.Time   `json:"expires_at"`
+	ResultsURL       string      `json:"results_url"`
+}
+
+// BatchCounts tallies the requests in a batch by outcome
+type BatchCounts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+// BatchResult is the outcome of one request in an ended batch
+type BatchResult struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		// Type is "succeeded", "errored", "canceled" or "expired"
+		Type    string                    `json:"type"`
+		Message *models.AnthropicResponse `json:"message,omitempty"`
+		Error   *struct {
+			Error models.StreamError `json:"error"`
+		} `json:"error,omitempty"`
+	} `json:"result"`
+}
+
+// Text returns the answer of a successful result
+func (r BatchResult) Text() string {
+	if r.Result.Message == nil {
+		return ""
+	}
+	return textOf(r.Result.Message.Content)
+}
+
+// Err describes why a request in the batch did not succeed, or returns nil
+func (r BatchResult) Err() error {
+	switch r.Result.Type {
+	case "succeeded":
+		return nil
+	case "errored":
+		if r.Result.Error != nil {
+			return fmt.Errorf("%s: %s", r.Result.Error.Error.Type, r.Result.Error.Error.Message)
+		}
+		return fmt.Errorf("request failed")
+	default:
+		return fmt.Errorf("request %s", r.Result.Type)
+	}
+}
+
+// BatchRequest builds one prompt of a Message Batch, with the model, token
+// limit and system prompt configured for its task. Tools and attachments are
+// not included.
+func (c *Client) BatchRequest(customID string, chat ChatRequest) (BatchRequest, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if !batchIDPattern.MatchString(customID) {
+		return BatchRequest{}, fmt.Errorf("invalid batch request id %q: use up to 64 letters, digits, - and _", customID)
+	}
+
+	requestBody := c.newRequest(chat.Task, chat.System)
+	requestBody.Messages = []models.Message{textMessage("user", chat.Prompt)}
+	if c.Config.PromptCaching {
+		requestBody = withCacheBreakpoints(requestBody, 0)
+	}
+
+	return BatchRequest{CustomID: customID, Params: requestBody}, nil
+}
+
+// CreateBatch submits prompts to be answered asynchronously, at a lower cost
+// than answering them one at a time. Only the Anthropic backend has batches.
+func (c *Client) CreateBatch(ctx context.Context, requests []BatchRequest) (*Batch, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("a batch needs at least one request")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"requests": requests})
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	var batch Batch
+	if err := c.batchCall(ctx, "POST", c.batchesURL(""), body, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetBatch fetches the current status of a batch
+func (c *Client) GetBatch(ctx context.Context, id string) (*Batch, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var batch Batch
+	if err := c.batchCall(ctx, "GET", c.batchesURL("/"+id), nil, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// CancelBatch asks for a batch to stop processing. Requests already answered
+// still have results.
+func (c *Client) CancelBatch(ctx context.Context, id string) (*Batch, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var batch Batch
+	if err := c.batchCall(ctx, "POST", c.batchesURL("/"+id+"/cancel"), nil, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// BatchResults downloads the results of an ended batch and accounts for the
+// tokens they used under task
+func (c *Client) BatchResults(ctx context.Context, batch *Batch, task string) ([]BatchResult, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if batch.ProcessingStatus != BatchEnded {
+		return nil, fmt.Errorf("batch %s has not finished processing", batch.ID)
+	}
+
+	resultsURL := batch.ResultsURL
+	if resultsURL == "" {
+		resultsURL = c.batchesURL("/" + batch.ID + "/results")
+	}
+
+	resp, err := c.batchDo(ctx, "GET", resultsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Results are JSON Lines, one per request, and can be large
+	var results []BatchResult
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var result BatchResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			return nil, fmt.Errorf("error decoding batch result: %v", err)
+		}
+		if message := result.Result.Message; message != nil && c.Usage != nil {
+			c.Usage.RecordBatch(task, message.Model, message.Usage)
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading batch results: %v", err)
+	}
+
+	return results, nil
+}
+
+// batchesURL returns the URL of the batches endpoint with path appended
+func (c *Client) batchesURL(path string) string {
+	return anthropicURL(c.Config.AnthropicBaseURL, "/v1/messages/batches"+path)
+}
+
+// batchCall makes a request to the batches API and decodes its JSON response
+// into out
+func (c *Client) batchCall(ctx context.Context, method string, url string, body []byte, out interface{}) error {
+	resp, err := c.batchDo(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
+
+// batchDo makes a request to the batches API, returning an APIError if it
+// does not succeed. The caller closes the response body.
+func (c *Client) batchDo(ctx context.Context, method string, url string, body []byte) (*http.Response, error) {
+	if c.Config.Backend == config.BackendOpenAI {
+		return nil, fmt.Errorf("message batches are only available with the Anthropic backend")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, batchTimeout)
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	setAnthropicHeaders(req, c.Config.AnthropicAPIKey)
+
+	resp, err := httpClientOrDefault(c.HTTPClient).Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("error making request to Claude: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer cancel()
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp, bodyBytes)
+	}
+
+	// The timeout ends once the caller has read and closed the body
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context when its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
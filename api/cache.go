@@ -0,0 +1,44 @@
+package api
+
+import "terminal-claude/models"
+
+// minCachedPromptLength is roughly the smallest prompt, in characters, worth
+// caching on its own; the API will not cache prefixes under about 1024 tokens
+const minCachedPromptLength = 4000
+
+// withCacheBreakpoints returns a copy of a request with cache breakpoints on
+// its stable prefixes: the tools and system prompt, a large provider-derived
+// prompt starting at message promptIndex (fetched page text, channel history
+// or email listings), and the newest turn so that follow-ups reuse the whole
+// conversation so far. The API allows at most four breakpoints; this uses
+// three. Messages shared with the conversation are copied before marking.
+func withCacheBreakpoints(requestBody models.AnthropicRequest, promptIndex int) models.AnthropicRequest {
+	if len(requestBody.System) > 0 {
+		requestBody.System = markLastBlock(requestBody.System)
+	}
+
+	messages := make([]models.Message, len(requestBody.Messages))
+	copy(messages, requestBody.Messages)
+
+	if promptIndex < len(messages) && len(textOf(messages[promptIndex].Content)) >= minCachedPromptLength {
+		messages[promptIndex].Content = markLastBlock(messages[promptIndex].Content)
+	}
+	if last := len(messages) - 1; last >= 0 {
+		messages[last].Content = markLastBlock(messages[last].Content)
+	}
+
+	requestBody.Messages = messages
+	return requestBody
+}
+
+// markLastBlock returns a copy of content with a cache breakpoint on its
+// final block
+func markLastBlock(content []models.MessageContent) []models.MessageContent {
+	if len(content) == 0 {
+		return content
+	}
+	marked := make([]models.MessageContent, len(content))
+	copy(marked, content)
+	marked[len(marked)-1].CacheControl = models.EphemeralCache()
+	return marked
+}
@@ -1,40 +1,190 @@
 package api
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"sync"
+	"terminal-claude/cache"
 	"terminal-claude/config"
 	"terminal-claude/models"
+	"terminal-claude/usage"
+	"time"
 )
 
-// Client represents a Claude API client
+// requestTimeout bounds a single attempt at a request, including reading a
+// streamed response
+const requestTimeout = 5 * time.Minute
+
+// Client represents a Claude API client. It implements LLM on top of a
+// Backend, adding conversations, tool use, retries and usage accounting.
 type Client struct {
 	Config config.Config
+	
+	// Backend sends each request; NewClient picks it from Config.Backend
+	Backend Backend
+	
+	// Usage, when set, accounts for the tokens used by every request
+	Usage *usage.Tracker
+	
+	// Cache, when set, answers a request repeated within its TTL with the
+	// earlier answer instead of calling the API again
+	Cache *cache.Store
+	
+	// HTTPClient sends requests that bypass the Backend, such as message
+	// batches; nil means http.DefaultClient
+	HTTPClient *http.Client
+	
+	// mutex lets Reconfigure wait for requests in flight, which finish with
+	// the settings they started with
+	mutex sync.RWMutex
 }
 
 // NewClient creates a new Claude API client
 func NewClient(cfg config.Config) *Client {
+	return NewClientWithHTTPClient(cfg, nil)
+}
+
+// NewClientWithHTTPClient creates a Claude API client that sends every
+// request through httpClient, such as one recording or replaying a cassette.
+// A nil httpClient means http.DefaultClient.
+func NewClientWithHTTPClient(cfg config.Config, httpClient *http.Client) *Client {
 	return &Client{
-		Config: cfg,
+		Config:     cfg,
+		Backend:    newBackend(cfg, httpClient),
+		HTTPClient: httpClient,
+	}
+}
+
+// newBackend returns the backend selected by cfg.Backend
+func newBackend(cfg config.Config, httpClient *http.Client) Backend {
+	switch cfg.Backend {
+	case config.BackendOpenAI:
+		return &OpenAIBackend{BaseURL: cfg.OpenAIBaseURL, APIKey: cfg.OpenAIAPIKey, HTTPClient: httpClient}
+	default:
+		return &AnthropicBackend{APIKey: cfg.AnthropicAPIKey, BaseURL: cfg.AnthropicBaseURL, HTTPClient: httpClient}
 	}
 }
 
+// Reconfigure switches to new settings, and the response cache to use (nil
+// for none), from the next request on. It waits for requests in flight to
+// finish first.
+func (c *Client) Reconfigure(cfg config.Config, responseCache *cache.Store) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Config = cfg
+	c.Backend = newBackend(cfg, c.HTTPClient)
+	c.Cache = responseCache
+}
+
+// StreamFunc receives each piece of response text as it is generated
+type StreamFunc func(delta string)
+
+// Response is Claude's answer to a ChatRequest
+type Response struct {
+	Text string
+	
+	// Thinking is Claude's reasoning before it answered, when extended
+	// thinking is enabled
+	Thinking string
+	
+	// StopReason is why the final request stopped, e.g. "end_turn"
+	StopReason string
+	
+	// Truncated is set when the answer was still cut off by the token limit
+	// after every allowed continuation
+	Truncated bool
+	
+	// Continuations counts the follow-up requests made to finish a long answer
+	Continuations int
+	
+	// Usage totals the tokens used by every request made for the answer
+	Usage models.Usage
+	
+	// Cached is set when every request made for the answer was answered
+	// from the response cache, so it cost nothing
+	Cached bool
+	
+	// requests and cacheHits count the requests made for the answer and
+	// how many of them were answered from the response cache
+	requests  int
+	cacheHits int
+}
+
 // Ask sends a prompt to Claude AI and returns the response
-func (c *Client) Ask(prompt string) (string, error) {
-	url := "https://api.anthropic.com/v1/messages"
+func (c *Client) Ask(ctx context.Context, prompt string) (string, error) {
+	return c.AskStream(ctx, prompt, nil)
+}
+
+// AskStream sends a prompt to Claude AI and returns the response. When onDelta
+// is non-nil the response is streamed and each text delta is passed to it as
+// soon as it arrives.
+func (c *Client) AskStream(ctx context.Context, prompt string, onDelta StreamFunc) (string, error) {
+	return c.Chat(ctx, nil, prompt, onDelta)
+}
+
+// Task names used to route requests to a model
+const (
+	TaskChat    = "chat"
+	TaskEmail   = "email"
+	TaskSlack   = "slack"
+	TaskWebpage = "webpage"
+)
+
+// ChatRequest describes a prompt to send to Claude
+type ChatRequest struct {
+	// Task selects the configured model route; empty means TaskChat
+	Task   string
+	Prompt string
 	
-	// Force the correct model name
-	modelName := "claude-3-haiku-20240307"
+	// System replaces the configured system prompt when it is not empty
+	System string
 	
-	// Create a simpler message structure
-	requestBody := models.AnthropicRequest{
-		Model:     modelName, // Use the hardcoded model name for now
-		MaxTokens: 1024,
-		System:    "You are Claude, an AI assistant by Anthropic. You're helpful, harmless, and honest.",
+	// Conversation holds the earlier turns to send along with the prompt and
+	// records the exchange once it succeeds. Nil sends the prompt on its own.
+	Conversation *Conversation
+	
+	// Tools are offered to Claude, and each call it makes is executed with
+	// RunTool and the result handed back until Claude gives its final answer
+	Tools   []models.Tool
+	RunTool ToolFunc
+	
+	// Attachments are image and document blocks, as built by LoadAttachment,
+	// sent ahead of the prompt text
+	Attachments []models.MessageContent
+	
+	// OnDelta, when non-nil, streams the response text as it is generated
+	OnDelta StreamFunc
+}
+
+// Chat sends a prompt to Claude AI as the next turn of conv and returns the
+// response. Earlier turns are sent along with the prompt, and the exchange is
+// recorded in conv once it succeeds. A nil conv sends the prompt on its own.
+func (c *Client) Chat(ctx context.Context, conv *Conversation, prompt string, onDelta StreamFunc) (string, error) {
+	response, err := c.Send(ctx, ChatRequest{
+		Prompt:       prompt,
+		Conversation: conv,
+		OnDelta:      onDelta,
+	})
+	if err != nil {
+		return "", err
 	}
+	return response.Text, nil
+}
+
+// Send sends a prompt to Claude AI as described by chat and returns the
+// response. Cancelling ctx abandons the request, including any tool calls.
+func (c *Client) Send(ctx context.Context, chat ChatRequest) (*Response, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	
+	prompt := chat.Prompt
+	conv := chat.Conversation
+	onDelta := chat.OnDelta
+	
+	requestBody := c.newRequest(chat.Task, chat.System)
+	requestBody.Tools = chat.Tools
 	
 	// Check if the prompt might be too long or has formatting issues
 	if len(prompt) > 100000 {
@@ -48,68 +198,296 @@ func (c *Client) Ask(prompt string) (string, error) {
 	}
 	
 	// Create proper content structure for the user message
-	requestBody.Messages = []models.Message{
-		{
-			Role: "user",
-			Content: []models.MessageContent{
-				{
-					Type: "text",
-					Text: prompt,
-				},
-			},
-		},
-	}
+	userMessage := textMessage("user", prompt)
 	
 	// Verify content is not empty
-	if len(requestBody.Messages) == 0 || len(requestBody.Messages[0].Content) == 0 {
-		return "", fmt.Errorf("cannot create empty message content")
+	if userMessage.Content[0].Text == "" {
+		return nil, fmt.Errorf("message text cannot be empty")
 	}
 	
-	if requestBody.Messages[0].Content[0].Text == "" {
-		return "", fmt.Errorf("message text cannot be empty")
+	// Images and documents go before the text that asks about them
+	if len(chat.Attachments) > 0 {
+		userMessage.Content = append(append([]models.MessageContent{}, chat.Attachments...), userMessage.Content...)
 	}
 	
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
+	// Send the earlier turns of the conversation along with the new prompt
+	var history []models.Message
+	if conv != nil {
+		history = conv.Messages()
 	}
+	turns := []models.Message{userMessage}
 	
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	response := &Response{}
+	for round := 0; ; round++ {
+		requestBody.Messages = append(history[:len(history):len(history)], turns...)
+		
+		result, err := c.complete(ctx, chat.Task, requestBody, len(history), separateRounds(onDelta, response.Text != ""), response)
+		if err != nil {
+			return nil, err
+		}
+		
+		// Extract the text from the response
+		if text := textOf(result.Content); text != "" {
+			if response.Text != "" {
+				response.Text += "\n\n"
+			}
+			response.Text += text
+		}
+		if thinking := thinkingOf(result.Content); thinking != "" {
+			if response.Thinking != "" {
+				response.Thinking += "\n\n"
+			}
+			response.Thinking += thinking
+		}
+		
+		turns = append(turns, models.Message{
+			Role:    "assistant",
+			Content: assistantContent(result.Content),
+		})
+		
+		// A tool call cut off by the token limit cannot be run
+		response.StopReason = result.StopReason
+		response.Truncated = result.StopReason == "max_tokens"
+		
+		calls := toolCalls(result.Content)
+		if len(calls) == 0 || chat.RunTool == nil || response.Truncated {
+			break
+		}
+		if round >= maxToolRounds {
+			return nil, fmt.Errorf("Claude was still using tools after %d rounds", maxToolRounds)
+		}
+		
+		turns = append(turns, models.Message{
+			Role:    "user",
+			Content: runToolCalls(ctx, calls, chat.RunTool),
+		})
+	}
+	
+	// An empty assistant turn would be rejected on the next request, so only
+	// complete exchanges are remembered
+	if conv != nil && response.Text != "" {
+		conv.Append(turns...)
+	}
+	
+	return response, nil
+}
+
+// newRequest starts a request for a task with the model, token limit,
+// thinking budget and system prompt configured for it
+func (c *Client) newRequest(task string, system string) models.AnthropicRequest {
+	model, maxTokens := c.route(task)
+	requestBody := models.AnthropicRequest{
+		Model:     model,
+		MaxTokens: maxTokens,
+		System:    c.system(task, system),
+	}
+	
+	// Thinking comes out of the same token limit as the answer, so the limit
+	// is raised to leave the configured room for the answer itself
+	if budget := c.thinkingBudget(task); budget > 0 {
+		requestBody.Thinking = &models.ThinkingConfig{Type: "enabled", BudgetTokens: budget}
+		requestBody.MaxTokens += budget
+	}
+	
+	return requestBody
+}
+
+// complete sends a request and, while the response stops at the token limit
+// part way through its text, asks Claude to carry on from where it stopped,
+// up to Config.MaxContinuations times. The pieces are stitched together into
+// a single response, and the usage of every request is added to response.
+func (c *Client) complete(ctx context.Context, task string, requestBody models.AnthropicRequest, promptIndex int, onDelta StreamFunc, response *Response) (*models.AnthropicResponse, error) {
+	result, err := c.request(ctx, task, requestBody, promptIndex, onDelta, response)
 	if err != nil {
-		return "", fmt.Errorf("error creating HTTP request: %v", err)
+		return nil, err
+	}
+	
+	// OpenAI-compatible servers answer a trailing assistant turn with a new
+	// reply rather than continuing it, so only Claude is asked to carry on
+	if c.Config.Backend == config.BackendOpenAI {
+		return result, nil
+	}
+	
+	// Nor can an answer be continued once Claude has been thinking, as the
+	// API does not accept a partial assistant turn with thinking enabled
+	if requestBody.Thinking != nil {
+		return result, nil
+	}
+	
+	for result.StopReason == "max_tokens" && response.Continuations < c.Config.MaxContinuations {
+		partial, ok := continuationPrefill(result.Content)
+		if !ok {
+			break
+		}
+		
+		continuation := requestBody
+		continuation.Messages = append(requestBody.Messages[:len(requestBody.Messages):len(requestBody.Messages)], models.Message{
+			Role:    "assistant",
+			Content: partial,
+		})
+		
+		next, err := c.request(ctx, task, continuation, promptIndex, onDelta, response)
+		if err != nil {
+			return nil, err
+		}
+		response.Continuations++
+		
+		// Claude picks up mid-sentence, so the first new text block extends
+		// the last one of the partial response
+		merged := next.Content
+		if len(merged) > 0 && merged[0].Type == "text" {
+			partial[len(partial)-1].Text += merged[0].Text
+			merged = merged[1:]
+		}
+		result.Content = append(partial, merged...)
+		result.StopReason = next.StopReason
 	}
 	
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", c.Config.AnthropicAPIKey)
-	req.Header.Set("anthropic-version", "2023-06-01") 
-	// Use a newer API version
-	req.Header.Set("anthropic-beta", "messages-2023-12-15")
+	return result, nil
+}
+
+// request sends a single request, with retries, marking cache breakpoints
+// when prompt caching is enabled and accounting for the tokens it used. An
+// identical request made recently is answered from the response cache
+// instead, when there is one.
+func (c *Client) request(ctx context.Context, task string, requestBody models.AnthropicRequest, promptIndex int, onDelta StreamFunc, response *Response) (*models.AnthropicResponse, error) {
+	response.requests++
+	key, cacheable := c.responseCacheKey(requestBody)
+	if cacheable {
+		if result, ok := c.cachedResponse(key, onDelta); ok {
+			response.cacheHits++
+			response.Cached = response.cacheHits == response.requests
+			return result, nil
+		}
+	}
+	response.Cached = false
 	
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	if c.Config.PromptCaching {
+		requestBody = withCacheBreakpoints(requestBody, promptIndex)
+	}
+	
+	result, err := c.send(ctx, requestBody, onDelta)
 	if err != nil {
-		return "", fmt.Errorf("error making request to Claude: %v", err)
+		return nil, err
+	}
+	if cacheable {
+		c.storeResponse(key, result)
+	}
+	
+	c.recordUsage(task, requestBody.Model, result)
+	response.Usage.InputTokens += result.Usage.InputTokens
+	response.Usage.OutputTokens += result.Usage.OutputTokens
+	response.Usage.CacheCreationInputTokens += result.Usage.CacheCreationInputTokens
+	response.Usage.CacheReadInputTokens += result.Usage.CacheReadInputTokens
+	
+	return result, nil
+}
+
+// recordUsage accounts for the tokens used by a response
+func (c *Client) recordUsage(task string, model string, result *models.AnthropicResponse) {
+	if c.Usage == nil {
+		return
+	}
+	if task == "" {
+		task = TaskChat
+	}
+	// Prefer the model the API reports, as aliases resolve to dated versions
+	if result.Model != "" {
+		model = result.Model
+	}
+	c.Usage.Record(task, model, result.Usage)
+}
+
+// thinkingBudget returns the extended thinking budget configured for a task,
+// or zero when thinking is disabled. Only Claude supports thinking.
+func (c *Client) thinkingBudget(task string) int {
+	if c.Config.Backend == config.BackendOpenAI {
+		return 0
+	}
+	if task == "" {
+		task = TaskChat
+	}
+	if route, ok := c.Config.Routes[task]; ok && route.ThinkingBudget > 0 {
+		return route.ThinkingBudget
+	}
+	return c.Config.ThinkingBudget
+}
+
+// system returns the system prompt blocks for a request: prompt if it is
+// set, otherwise the configured prompt for the task and starting persona
+func (c *Client) system(task string, prompt string) []models.MessageContent {
+	if prompt == "" {
+		if task == "" {
+			task = TaskChat
+		}
+		prompt = c.Config.Prompts.SystemPrompt(task, c.Config.Prompts.Persona)
+	}
+	return []models.MessageContent{{Type: "text", Text: prompt}}
+}
+
+// route returns the model and maximum response length configured for a task
+func (c *Client) route(task string) (string, int) {
+	if task == "" {
+		task = TaskChat
 	}
-	defer resp.Body.Close()
 	
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		errorMsg := string(bodyBytes)
-		return "", fmt.Errorf("error from Claude API (Status %d): %s", resp.StatusCode, errorMsg)
+	model := c.Config.Model
+	maxTokens := c.Config.MaxTokens
+	if route, ok := c.Config.Routes[task]; ok {
+		if route.Model != "" {
+			model = route.Model
+		}
+		if route.MaxTokens > 0 {
+			maxTokens = route.MaxTokens
+		}
 	}
 	
-	var result models.AnthropicResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("error decoding response: %v", err)
+	if maxTokens <= 0 {
+		maxTokens = config.DefaultMaxTokens
 	}
 	
-	// Extract the text from the response
-	var responseText string
-	for _, content := range result.Content {
-		if content.Type == "text" {
-			responseText += content.Text
+	return model, maxTokens
+}
+
+// send posts a request to the backend, streaming the response through
+// onDelta when it is non-nil. Rate limiting, overloading and other transient
+// failures are retried with backoff, unless part of a streamed response has
+// already been passed on.
+func (c *Client) send(ctx context.Context, requestBody models.AnthropicRequest, onDelta StreamFunc) (*models.AnthropicResponse, error) {
+	// Note whether any text reached the caller, as it cannot be taken back
+	streamed := false
+	trackedDelta := onDelta
+	if onDelta != nil {
+		trackedDelta = func(delta string) {
+			streamed = true
+			onDelta(delta)
 		}
 	}
 	
-	return responseText, nil
+	for attempt := 0; ; attempt++ {
+		result, err := c.Backend.Complete(ctx, requestBody, trackedDelta)
+		if err == nil {
+			return result, nil
+		}
+		
+		var retryAfter time.Duration
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			apiErr.Attempts = attempt + 1
+			if !apiErr.Retryable() {
+				return nil, apiErr
+			}
+			retryAfter = apiErr.RetryAfter
+		}
+		
+		if streamed || attempt >= maxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+		
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryDelay(attempt, retryAfter)):
+		}
+	}
 }
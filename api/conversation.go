@@ -0,0 +1,91 @@
+package api
+
+import (
+	"sync"
+	"terminal-claude/models"
+)
+
+// maxConversationMessages bounds how many turns are resent with each request
+const maxConversationMessages = 40
+
+// Conversation accumulates the turns exchanged with Claude so that follow-up
+// prompts can refer to what was said before
+type Conversation struct {
+	mutex    sync.Mutex
+	messages []models.Message
+}
+
+// NewConversation creates an empty conversation
+func NewConversation() *Conversation {
+	return &Conversation{}
+}
+
+// Messages returns a copy of the turns recorded so far
+func (c *Conversation) Messages() []models.Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	messages := make([]models.Message, len(c.messages))
+	copy(messages, c.messages)
+	return messages
+}
+
+// Len returns the number of turns recorded so far
+func (c *Conversation) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.messages)
+}
+
+// Append records a completed exchange, dropping the oldest turns once the
+// conversation grows past maxConversationMessages
+func (c *Conversation) Append(messages ...models.Message) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.messages = append(c.messages, messages...)
+
+	// Trim from the front, keeping the history starting with a user prompt
+	// rather than an assistant reply or an orphaned tool result
+	for len(c.messages) > maxConversationMessages || (len(c.messages) > 0 && !isPrompt(c.messages[0])) {
+		c.messages = c.messages[1:]
+	}
+}
+
+// Record appends a prompt and the response given to it as a completed exchange
+func (c *Conversation) Record(prompt, response string) {
+	c.Append(textMessage("user", prompt), textMessage("assistant", response))
+}
+
+// Reset forgets every turn so the next prompt starts a new conversation
+func (c *Conversation) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.messages = nil
+}
+
+// isPrompt reports whether a message is a user turn that can open a conversation
+func isPrompt(message models.Message) bool {
+	if message.Role != "user" {
+		return false
+	}
+	for _, block := range message.Content {
+		if block.Type == "tool_result" {
+			return false
+		}
+	}
+	return true
+}
+
+// textMessage builds a message holding a single text block
+func textMessage(role, text string) models.Message {
+	return models.Message{
+		Role: role,
+		Content: []models.MessageContent{
+			{
+				Type: "text",
+				Text: text,
+			},
+		},
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is returned when the Claude API reports an error, either as an
+// error status or as an error event part way through a streamed response
+type APIError struct {
+	StatusCode int    // HTTP status, or 0 for errors reported mid-stream
+	Type       string // e.g. "rate_limit_error" or "overloaded_error"
+	Message    string
+	RequestID  string
+
+	// RetryAfter is how long the API asked us to wait before retrying
+	RetryAfter time.Duration
+
+	// Attempts is how many times the request was sent before giving up
+	Attempts int
+
+	// shouldRetry holds the API's own retry advice, when it gave any
+	shouldRetry *bool
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	msg := "error from Claude API stream ("
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("error from Claude API (Status %d", e.StatusCode)
+	}
+	if e.Type != "" {
+		if e.StatusCode != 0 {
+			msg += ", "
+		}
+		msg += e.Type
+	}
+	msg += "): " + e.Message
+	if e.RequestID != "" {
+		msg += " [request-id " + e.RequestID + "]"
+	}
+	return msg
+}
+
+// Retryable reports whether sending the same request again may succeed
+func (e *APIError) Retryable() bool {
+	if e.shouldRetry != nil {
+		return *e.shouldRetry
+	}
+
+	switch e.Type {
+	case "rate_limit_error", "overloaded_error", "api_error":
+		return true
+	}
+
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests, 529:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// Description explains the error in terms a user can act on
+func (e *APIError) Description() string {
+	var desc string
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests || e.Type == "rate_limit_error":
+		desc = "Rate limited by the Claude API. Too many requests or tokens were sent in a short time"
+		if e.RetryAfter > 0 {
+			desc += fmt.Sprintf("; try again in %s", e.RetryAfter.Round(time.Second))
+		} else {
+			desc += "; try again shortly"
+		}
+	case e.StatusCode == 529 || e.Type == "overloaded_error":
+		desc = "Claude is overloaded right now. This is temporary; try again in a minute"
+	case e.StatusCode == http.StatusUnauthorized || e.Type == "authentication_error":
+		desc = "Authentication with the Claude API failed. Check that ANTHROPIC_API_KEY is set to a valid key"
+	case e.StatusCode == http.StatusForbidden || e.Type == "permission_error":
+		desc = "Your API key does not have permission for this request: " + e.Message
+	case e.StatusCode == http.StatusNotFound || e.Type == "not_found_error":
+		desc = "The Claude API could not find what was requested. Check the configured model name: " + e.Message
+	case e.StatusCode == http.StatusRequestEntityTooLarge || e.Type == "request_too_large":
+		desc = "The request was too large for the Claude API. Try a shorter prompt or start a new conversation with /new"
+	case e.StatusCode == http.StatusBadRequest || e.Type == "invalid_request_error":
+		desc = "The Claude API rejected the request as invalid: " + e.Message
+	default:
+		desc = "The Claude API reported an error: " + e.Message
+	}
+
+	if e.Attempts > 1 {
+		desc += fmt.Sprintf(" (gave up after %d attempts)", e.Attempts)
+	}
+	if e.RequestID != "" {
+		desc += " [request-id " + e.RequestID + "]"
+	}
+	return desc
+}
+
+// newAPIError builds an APIError from an error response
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("request-id"),
+		RetryAfter: parseRetryAfter(resp.Header.Get("retry-after")),
+		Message:    strings.TrimSpace(string(body)),
+	}
+
+	var payload struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Error.Type != "" {
+		apiErr.Type = payload.Error.Type
+		apiErr.Message = payload.Error.Message
+	}
+
+	if advice := resp.Header.Get("x-should-retry"); advice != "" {
+		shouldRetry := advice == "true"
+		apiErr.shouldRetry = &shouldRetry
+	}
+
+	return apiErr
+}
+
+// parseRetryAfter reads a retry-after header given in seconds or as a date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"terminal-claude/models"
+)
+
+// maxExtractAttempts bounds how many times Claude is asked to correct data
+// that does not match the schema
+const maxExtractAttempts = 3
+
+// ExtractRequest describes structured data to pull out of a prompt
+type ExtractRequest struct {
+	// Task selects the configured model route; empty means TaskChat
+	Task   string
+	Prompt string
+
+	// System replaces the configured system prompt when it is not empty
+	System string
+
+	// Name and Description tell Claude what the data is. Name must be a valid
+	// tool name and defaults to "record".
+	Name        string
+	Description string
+
+	// Schema is the JSON Schema the data must match. When nil it is derived
+	// from the type being decoded into with SchemaFor.
+	Schema map[string]interface{}
+}
+
+// Extract asks Claude for data matching req.Schema and decodes it into out.
+// Claude is made to answer by calling a tool whose input is the data, and
+// input that does not match the schema is handed back for correction.
+func (c *Client) Extract(ctx context.Context, req ExtractRequest, out interface{}) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	schema := req.Schema
+	if schema == nil {
+		var err error
+		if schema, err = SchemaFor(out); err != nil {
+			return fmt.Errorf("unable to derive a schema: %v", err)
+		}
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "record"
+	}
+
+	model, maxTokens := c.route(req.Task)
+	requestBody := models.AnthropicRequest{
+		Model:     model,
+		MaxTokens: maxTokens,
+		System:    c.system(req.Task, req.System),
+		Messages:  []models.Message{textMessage("user", req.Prompt)},
+		Tools: []models.Tool{{
+			Name:        name,
+			Description: req.Description,
+			InputSchema: schema,
+		}},
+		ToolChoice: &models.ToolChoice{Type: "tool", Name: name},
+	}
+
+	response := &Response{}
+	for attempt := 1; ; attempt++ {
+		result, err := c.request(ctx, req.Task, requestBody, 0, nil, response)
+		if err != nil {
+			return err
+		}
+		if result.StopReason == "max_tokens" {
+			return fmt.Errorf("the %s was cut off by the token limit of %d", name, maxTokens)
+		}
+
+		var call *models.MessageContent
+		for i := range result.Content {
+			if result.Content[i].Type == "tool_use" && result.Content[i].Name == name {
+				call = &result.Content[i]
+				break
+			}
+		}
+		if call == nil {
+			return fmt.Errorf("Claude did not return a %s", name)
+		}
+
+		err = DecodeStructured(schema, call.Input, out)
+		if err == nil {
+			return nil
+		}
+		if attempt >= maxExtractAttempts {
+			return fmt.Errorf("the %s did not match its schema: %v", name, err)
+		}
+
+		// Point out the mistake and ask again
+		requestBody.Messages = append(requestBody.Messages,
+			models.Message{Role: "assistant", Content: assistantContent(result.Content)},
+			models.Message{Role: "user", Content: []models.MessageContent{{
+				Type:      "tool_result",
+				ToolUseID: call.ID,
+				Content:   fmt.Sprintf("Invalid %s: %v. Please call %s again with corrected input.", name, err, name),
+				IsError:   true,
+			}}},
+		)
+	}
+}
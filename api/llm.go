@@ -0,0 +1,27 @@
+package api
+
+import (
+	"context"
+	"terminal-claude/models"
+)
+
+// LLM answers prompts. Client is the standard implementation; tests can
+// substitute the scripted fake in the apitest package.
+type LLM interface {
+	// Send sends a prompt as described by chat and returns the response,
+	// streaming it, running tools and recording the conversation as requested
+	Send(ctx context.Context, chat ChatRequest) (*Response, error)
+	
+	// Extract asks for data matching a JSON Schema and decodes it into out
+	Extract(ctx context.Context, req ExtractRequest, out interface{}) error
+}
+
+// Backend makes a single Messages request to a model provider. Requests and
+// responses use the Anthropic shapes; other providers translate to and from
+// them. A response is streamed through onDelta when it is non-nil.
+type Backend interface {
+	Complete(ctx context.Context, requestBody models.AnthropicRequest, onDelta StreamFunc) (*models.AnthropicResponse, error)
+}
+
+// Client is the default LLM
+var _ LLM = (*Client)(nil)
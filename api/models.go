@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"terminal-claude/config"
+	"time"
+)
+
+// modelTimeout bounds a request to look up a model
+const modelTimeout = 30 * time.Second
+
+// ModelInfo describes a model as reported by the API
+type ModelInfo struct {
+	ID          string    `json:"id"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GetModel looks up a model, or an alias for one, without using any tokens.
+// As the request is authenticated it also checks the API key. Only the
+// Anthropic backend can be asked.
+func (c *Client) GetModel(ctx context.Context, model string) (*ModelInfo, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.Config.Backend == config.BackendOpenAI {
+		return nil, fmt.Errorf("models can only be looked up with the Anthropic backend")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, modelTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", anthropicURL(c.Config.AnthropicBaseURL, "/v1/models/"+url.PathEscape(model)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	setAnthropicHeaders(req, c.Config.AnthropicAPIKey)
+
+	resp, err := httpClientOrDefault(c.HTTPClient).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to Claude: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, body)
+	}
+
+	var info ModelInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+	return &info, nil
+}
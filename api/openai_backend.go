@@ -0,0 +1,403 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"terminal-claude/models"
+)
+
+// OpenAIBackend sends requests to an OpenAI-compatible chat completions API,
+// such as those served by Ollama and llama.cpp, translating to and from the
+// Anthropic request and response shapes
+type OpenAIBackend struct {
+	BaseURL string
+	APIKey  string // optional for local servers
+
+	// HTTPClient sends the requests; nil means http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// openAIRequest is a chat completions request
+type openAIRequest struct {
+	Model         string               `json:"model"`
+	Messages      []openAIMessage      `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Tools         []openAITool         `json:"tools,omitempty"`
+	ToolChoice    interface{}          `json:"tool_choice,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+// openAIStreamOptions asks for token usage at the end of a stream
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIMessage is a single chat message
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+
+	// Parts replaces Content in requests whose message includes images
+	Parts []openAIContentPart `json:"-"`
+}
+
+// openAIContentPart is a piece of a message made up of text and images
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// MarshalJSON sends the content as a list of parts when there are any
+func (m openAIMessage) MarshalJSON() ([]byte, error) {
+	type message openAIMessage
+	if len(m.Parts) == 0 {
+		return json.Marshal(message(m))
+	}
+	return json.Marshal(struct {
+		message
+		Content []openAIContentPart `json:"content"`
+	}{message(m), m.Parts})
+}
+
+// openAIToolCall is a function call made by the assistant
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"` // only set in stream deltas
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// openAITool describes a function the assistant may call
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description"`
+		Parameters  map[string]interface{} `json:"parameters"`
+	} `json:"function"`
+}
+
+// openAIResponse is a chat completion, or a chunk of one when streaming
+type openAIResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		Delta        openAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// Complete makes a single attempt at a chat completions request
+func (b *OpenAIBackend) Complete(ctx context.Context, requestBody models.AnthropicRequest, onDelta StreamFunc) (*models.AnthropicResponse, error) {
+	request, err := toOpenAIRequest(requestBody)
+	if err != nil {
+		return nil, err
+	}
+	if onDelta != nil {
+		request.Stream = true
+		request.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(b.BaseURL, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if b.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.APIKey)
+	}
+
+	resp, err := httpClientOrDefault(b.HTTPClient).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to %s: %v", b.BaseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp, bodyBytes)
+	}
+
+	if request.Stream {
+		return readOpenAIStream(resp.Body, onDelta)
+	}
+
+	var result openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+	if len(result.Choices) == 0 {
+		return nil, fmt.Errorf("response contained no choices")
+	}
+
+	choice := result.Choices[0]
+	response := &models.AnthropicResponse{
+		ID:         result.ID,
+		Model:      result.Model,
+		StopReason: toStopReason(choice.FinishReason),
+	}
+	if choice.Message.Content != "" {
+		response.Content = append(response.Content, models.MessageContent{Type: "text", Text: choice.Message.Content})
+	}
+	for i, call := range choice.Message.ToolCalls {
+		response.Content = append(response.Content, toToolUse(i, call.ID, call.Function.Name, call.Function.Arguments))
+	}
+	if result.Usage != nil {
+		response.Usage.InputTokens = result.Usage.PromptTokens
+		response.Usage.OutputTokens = result.Usage.CompletionTokens
+	}
+
+	return response, nil
+}
+
+// readOpenAIStream consumes a streamed chat completion, passing text deltas
+// to onDelta and assembling the complete response
+func readOpenAIStream(body io.Reader, onDelta StreamFunc) (*models.AnthropicResponse, error) {
+	response := &models.AnthropicResponse{}
+	var text strings.Builder
+	calls := map[int]*openAIToolCall{}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	done := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		var chunk openAIResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("error decoding stream event: %v", err)
+		}
+
+		if chunk.ID != "" {
+			response.ID = chunk.ID
+		}
+		if chunk.Model != "" {
+			response.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			response.Usage.InputTokens = chunk.Usage.PromptTokens
+			response.Usage.OutputTokens = chunk.Usage.CompletionTokens
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				text.WriteString(choice.Delta.Content)
+				if onDelta != nil {
+					onDelta(choice.Delta.Content)
+				}
+			}
+
+			// Tool calls arrive in fragments, matched up by index
+			for i, fragment := range choice.Delta.ToolCalls {
+				index := i
+				if fragment.Index != nil {
+					index = *fragment.Index
+				}
+				call, ok := calls[index]
+				if !ok {
+					call = &openAIToolCall{}
+					calls[index] = call
+				}
+				if fragment.ID != "" {
+					call.ID = fragment.ID
+				}
+				call.Function.Name += fragment.Function.Name
+				call.Function.Arguments += fragment.Function.Arguments
+			}
+
+			if choice.FinishReason != "" {
+				response.StopReason = toStopReason(choice.FinishReason)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading response stream: %v", err)
+	}
+	if !done && response.StopReason == "" {
+		return nil, fmt.Errorf("response stream ended unexpectedly")
+	}
+
+	if text.Len() > 0 {
+		response.Content = append(response.Content, models.MessageContent{Type: "text", Text: text.String()})
+	}
+
+	indexes := make([]int, 0, len(calls))
+	for index := range calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		call := calls[index]
+		response.Content = append(response.Content, toToolUse(index, call.ID, call.Function.Name, call.Function.Arguments))
+	}
+
+	return response, nil
+}
+
+// toOpenAIRequest translates a Messages request into a chat completions request
+func toOpenAIRequest(requestBody models.AnthropicRequest) (openAIRequest, error) {
+	request := openAIRequest{
+		Model:     requestBody.Model,
+		MaxTokens: requestBody.MaxTokens,
+	}
+
+	var system string
+	for _, block := range requestBody.System {
+		system += block.Text
+	}
+	if system != "" {
+		request.Messages = append(request.Messages, openAIMessage{Role: "system", Content: system})
+	}
+
+	for _, message := range requestBody.Messages {
+		messages, err := toOpenAIMessages(message)
+		if err != nil {
+			return openAIRequest{}, err
+		}
+		request.Messages = append(request.Messages, messages...)
+	}
+
+	for _, tool := range requestBody.Tools {
+		var t openAITool
+		t.Type = "function"
+		t.Function.Name = tool.Name
+		t.Function.Description = tool.Description
+		t.Function.Parameters = tool.InputSchema
+		request.Tools = append(request.Tools, t)
+	}
+
+	if choice := requestBody.ToolChoice; choice != nil {
+		switch choice.Type {
+		case "tool":
+			request.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]string{"name": choice.Name},
+			}
+		case "any":
+			request.ToolChoice = "required"
+		default:
+			request.ToolChoice = choice.Type
+		}
+	}
+
+	return request, nil
+}
+
+// toOpenAIMessages translates one message. Tool results become separate
+// "tool" messages, tool calls are attached to the assistant message, and
+// images are sent as data URLs. Documents have no equivalent.
+func toOpenAIMessages(message models.Message) ([]openAIMessage, error) {
+	var messages []openAIMessage
+	main := openAIMessage{Role: message.Role}
+	hasImages := false
+
+	for _, block := range message.Content {
+		switch block.Type {
+		case "text":
+			main.Content += block.Text
+			main.Parts = append(main.Parts, openAIContentPart{Type: "text", Text: block.Text})
+		case "image":
+			part := openAIContentPart{Type: "image_url"}
+			part.ImageURL = &struct {
+				URL string `json:"url"`
+			}{URL: "data:" + block.Source.MediaType + ";base64," + block.Source.Data}
+			main.Parts = append(main.Parts, part)
+			hasImages = true
+		case "document":
+			return nil, fmt.Errorf("PDF attachments are not supported by the OpenAI-compatible backend")
+		case "tool_use":
+			var call openAIToolCall
+			call.ID = block.ID
+			call.Type = "function"
+			call.Function.Name = block.Name
+			call.Function.Arguments = string(block.Input)
+			main.ToolCalls = append(main.ToolCalls, call)
+		case "tool_result":
+			messages = append(messages, openAIMessage{
+				Role:       "tool",
+				Content:    block.Content,
+				ToolCallID: block.ToolUseID,
+			})
+		}
+	}
+
+	if !hasImages {
+		main.Parts = nil
+	}
+	if main.Content != "" || len(main.ToolCalls) > 0 || hasImages {
+		messages = append(messages, main)
+	}
+	return messages, nil
+}
+
+// toToolUse builds a tool_use block from the function call at index. Some
+// local servers leave out call ids, so one is made up to pair with the result.
+func toToolUse(index int, id string, name string, arguments string) models.MessageContent {
+	if id == "" {
+		id = fmt.Sprintf("call_%d", index)
+	}
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	return models.MessageContent{
+		Type:  "tool_use",
+		ID:    id,
+		Name:  name,
+		Input: json.RawMessage(arguments),
+	}
+}
+
+// toStopReason translates a finish reason into the matching stop reason
+func toStopReason(finishReason string) string {
+	switch finishReason {
+	case "stop":
+		return "end_turn"
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return finishReason
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"terminal-claude/cache"
+	"terminal-claude/models"
+)
+
+// cachedResponse returns the answer to an identical request made within the
+// response cache's TTL, passing its text to onDelta as if it had streamed
+func (c *Client) cachedResponse(key string, onDelta StreamFunc) (*models.AnthropicResponse, bool) {
+	var result models.AnthropicResponse
+	if !c.Cache.Get(key, &result) {
+		return nil, false
+	}
+	if onDelta != nil {
+		if text := textOf(result.Content); text != "" {
+			onDelta(text)
+		}
+	}
+	return &result, true
+}
+
+// responseCacheKey identifies a request by everything that shapes its
+// answer: the backend, model, system prompt, messages, tools and limits.
+// Cache breakpoints are added later, so they never affect the key.
+func (c *Client) responseCacheKey(requestBody models.AnthropicRequest) (string, bool) {
+	if c.Cache == nil {
+		return "", false
+	}
+	requestBody.Stream = false
+	key, err := cache.Key(c.Config.Backend, requestBody)
+	if err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// storeResponse keeps an answer for reuse. A complete answer is needed, as
+// one cut short by an error would be reused long after the error has passed.
+func (c *Client) storeResponse(key string, result *models.AnthropicResponse) {
+	if result.StopReason == "" {
+		return
+	}
+	// A cache that cannot be written only costs a repeated request later
+	c.Cache.Put(key, result)
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Retry policy for transient failures such as rate limiting and overloading
+const (
+	maxRetries     = 4
+	baseRetryDelay = time.Second
+	maxRetryDelay  = 30 * time.Second
+	maxRetryAfter  = 60 * time.Second
+)
+
+// retryDelay returns how long to wait before the given retry attempt
+// (starting at 0). A retry-after from the API is honoured; otherwise the
+// delay grows exponentially with full jitter so that clients hitting the
+// same limit do not retry in lockstep.
+func retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if retryAfter > maxRetryAfter {
+			return maxRetryAfter
+		}
+		return retryAfter
+	}
+
+	delay := baseRetryDelay << uint(attempt)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaFor derives a JSON Schema from the Go type of v, which is usually a
+// pointer to a struct. Fields are named by their json tags and are required
+// unless tagged omitempty. A `description` tag describes a field to the model
+// and an `enum` tag lists its allowed values, separated by commas.
+func SchemaFor(v interface{}) (map[string]interface{}, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, fmt.Errorf("cannot derive a schema from nil")
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return schemaOf(t)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf builds the schema for a type
+func schemaOf(t reflect.Type) (map[string]interface{}, error) {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}, nil
+		}
+		items, err := schemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys must be strings, not %s", t.Key())
+		}
+		values, err := schemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return structSchema(t)
+	}
+
+	return nil, fmt.Errorf("cannot describe %s in a JSON Schema", t)
+}
+
+// structSchema builds the schema for a struct from its exported fields
+func structSchema(t reflect.Type) (map[string]interface{}, error) {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := schemaOf(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", t.Name(), field.Name, err)
+		}
+		if description := field.Tag.Get("description"); description != "" {
+			property["description"] = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			var values []interface{}
+			for _, value := range strings.Split(enum, ",") {
+				values = append(values, strings.TrimSpace(value))
+			}
+			property["enum"] = values
+		}
+
+		properties[name] = property
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}, nil
+}
+
+// DecodeStructured checks raw against schema and, if it conforms, decodes it
+// into out. Only the parts of JSON Schema used to describe tool input are
+// checked: type, enum, properties, required, additionalProperties, items,
+// minimum and maximum.
+func DecodeStructured(schema map[string]interface{}, raw json.RawMessage, out interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	if err := validate(schema, value, ""); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("unable to decode: %v", err)
+	}
+	return nil
+}
+
+// validate checks a decoded JSON value against a schema. path locates the
+// value in error messages.
+func validate(schema map[string]interface{}, value interface{}, path string) error {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s, got %s", describePath(path), strings.Join(types, " or "), typeOf(value))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: %v is not one of %v", describePath(path), value, enum)
+		}
+	}
+
+	if number, ok := value.(json.Number); ok {
+		n, _ := number.Float64()
+		if minimum, ok := toFloat(schema["minimum"]); ok && n < minimum {
+			return fmt.Errorf("%s: %v is less than the minimum of %v", describePath(path), number, minimum)
+		}
+		if maximum, ok := toFloat(schema["maximum"]); ok && n > maximum {
+			return fmt.Errorf("%s: %v is more than the maximum of %v", describePath(path), number, maximum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(schema, v, path)
+	case []interface{}:
+		items, ok := schema["items"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range v {
+			if err := validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateObject checks an object's properties
+func validateObject(schema map[string]interface{}, object map[string]interface{}, path string) error {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	for _, name := range schemaStrings(schema["required"]) {
+		if _, ok := object[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", describePath(path), name)
+		}
+	}
+
+	// Check properties in a stable order so the same mistake gives the same error
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := name
+		if path != "" {
+			propertyPath = path + "." + name
+		}
+
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			if err := validate(property, object[name], propertyPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: unexpected property %q", describePath(path), name)
+			}
+		case map[string]interface{}:
+			if err := validate(additional, object[name], propertyPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasType reports whether a decoded JSON value is of a JSON Schema type
+func hasType(value interface{}, t string) bool {
+	switch v := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		_, err := v.Int64()
+		return t == "integer" && err == nil
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	}
+	return false
+}
+
+// typeOf names the JSON type of a decoded value for error messages
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaTypes reads a schema's "type", which may be a name or a list of them
+func schemaTypes(t interface{}) []string {
+	if name, ok := t.(string); ok {
+		return []string{name}
+	}
+	return schemaStrings(t)
+}
+
+// schemaStrings reads a list of strings from a schema built in Go or decoded
+// from JSON
+func schemaStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		var strs []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+// toFloat reads a number from a schema built in Go or decoded from JSON
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// describePath names the location of a value for error messages
+func describePath(path string) string {
+	if path == "" {
+		return "value"
+	}
+	return path
+}
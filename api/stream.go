@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"terminal-claude/models"
+)
+
+// readStream consumes a server-sent event stream from the Messages API,
+// passing text deltas to onDelta and assembling the complete response
+func readStream(body io.Reader, onDelta StreamFunc) (*models.AnthropicResponse, error) {
+	result := &models.AnthropicResponse{}
+	
+	// Tool inputs arrive as fragments of JSON, keyed by content block index
+	partialInputs := map[int]*strings.Builder{}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		// Only data lines carry a payload; event names are repeated inside it
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+		var event models.StreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("error decoding stream event: %v", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				result.ID = event.Message.ID
+				result.Model = event.Message.Model
+				result.Usage = event.Message.Usage
+			}
+		case "content_block_start":
+			for len(result.Content) <= event.Index {
+				result.Content = append(result.Content, models.MessageContent{})
+			}
+			if event.ContentBlock != nil {
+				result.Content[event.Index] = *event.ContentBlock
+			}
+		case "content_block_delta":
+			if event.Delta == nil || event.Index >= len(result.Content) {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				result.Content[event.Index].Text += event.Delta.Text
+				if onDelta != nil && event.Delta.Text != "" {
+					onDelta(event.Delta.Text)
+				}
+			case "thinking_delta":
+				result.Content[event.Index].Thinking += event.Delta.Thinking
+			case "signature_delta":
+				result.Content[event.Index].Signature += event.Delta.Signature
+			case "input_json_delta":
+				if partialInputs[event.Index] == nil {
+					partialInputs[event.Index] = &strings.Builder{}
+				}
+				partialInputs[event.Index].WriteString(event.Delta.PartialJSON)
+			}
+		case "content_block_stop":
+			if partial, ok := partialInputs[event.Index]; ok && event.Index < len(result.Content) && partial.Len() > 0 {
+				result.Content[event.Index].Input = json.RawMessage(partial.String())
+			}
+		case "message_delta":
+			if event.Delta != nil && event.Delta.StopReason != "" {
+				result.StopReason = event.Delta.StopReason
+			}
+			// Output token counts are cumulative, so the last one is the total
+			if event.Usage != nil {
+				result.Usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			return result, nil
+		case "error":
+			apiErr := &APIError{Message: "the response stream reported an error"}
+			if event.Error != nil {
+				apiErr.Type = event.Error.Type
+				apiErr.Message = event.Error.Message
+			}
+			return nil, apiErr
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading response stream: %v", err)
+	}
+
+	return nil, fmt.Errorf("response stream ended unexpectedly")
+}
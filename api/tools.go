@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"terminal-claude/models"
+)
+
+// maxToolRounds bounds how many times Claude may call tools before answering
+const maxToolRounds = 8
+
+// ToolFunc executes a tool Claude asked to use and returns its result as text
+type ToolFunc func(ctx context.Context, name string, input json.RawMessage) (string, error)
+
+// textOf joins the text blocks of a response
+func textOf(content []models.MessageContent) string {
+	var text string
+	for _, block := range content {
+		if block.Type == "text" {
+			text += block.Text
+		}
+	}
+	return text
+}
+
+// thinkingOf joins the reasoning in Claude's thinking blocks
+func thinkingOf(content []models.MessageContent) string {
+	var thoughts []string
+	for _, block := range content {
+		if block.Type == "thinking" && block.Thinking != "" {
+			thoughts = append(thoughts, block.Thinking)
+		}
+	}
+	return strings.Join(thoughts, "\n\n")
+}
+
+// toolCalls returns the tool_use blocks of a response
+func toolCalls(content []models.MessageContent) []models.MessageContent {
+	var calls []models.MessageContent
+	for _, block := range content {
+		if block.Type == "tool_use" {
+			calls = append(calls, block)
+		}
+	}
+	return calls
+}
+
+// assistantContent prepares response blocks to be sent back as an assistant
+// turn, dropping empty text blocks and filling in missing tool inputs, both
+// of which the API would reject
+func assistantContent(content []models.MessageContent) []models.MessageContent {
+	var blocks []models.MessageContent
+	for _, block := range content {
+		switch block.Type {
+		case "text":
+			if block.Text == "" {
+				continue
+			}
+		case "tool_use":
+			if len(block.Input) == 0 {
+				block.Input = json.RawMessage("{}")
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// runToolCalls executes each tool call and builds the matching tool_result
+// blocks. Failures are reported to Claude rather than aborting the exchange.
+func runToolCalls(ctx context.Context, calls []models.MessageContent, runTool ToolFunc) []models.MessageContent {
+	results := make([]models.MessageContent, 0, len(calls))
+	for _, call := range calls {
+		output, err := runTool(ctx, call.Name, call.Input)
+		result := models.MessageContent{
+			Type:      "tool_result",
+			ToolUseID: call.ID,
+			Content:   output,
+		}
+		if err != nil {
+			result.Content = err.Error()
+			result.IsError = true
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// separateRounds wraps onDelta so that text from a later round of a tool
+// exchange starts on a new paragraph
+func separateRounds(onDelta StreamFunc, afterText bool) StreamFunc {
+	if onDelta == nil || !afterText {
+		return onDelta
+	}
+	separated := false
+	return func(delta string) {
+		if !separated {
+			separated = true
+			onDelta("\n\n")
+		}
+		onDelta(delta)
+	}
+}
+
+// continuationPrefill prepares a response cut off by the token limit to be
+// sent back as a partial assistant turn for Claude to continue. It reports
+// false unless the response ends in text, as a cut off tool call cannot be
+// resumed. Trailing whitespace is trimmed since the API rejects it.
+func continuationPrefill(content []models.MessageContent) ([]models.MessageContent, bool) {
+	blocks := assistantContent(content)
+	if len(blocks) == 0 || blocks[len(blocks)-1].Type != "text" {
+		return nil, false
+	}
+
+	last := &blocks[len(blocks)-1]
+	last.Text = strings.TrimRight(last.Text, " \t\r\n")
+	if last.Text == "" {
+		return nil, false
+	}
+	return blocks, true
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"terminal-claude/api"
+	"terminal-claude/config"
+	"terminal-claude/handlers"
+	"terminal-claude/mcp"
+)
+
+const askUsage = `Usage: prodterm ask [flags] <prompt>
+
+Runs a single prompt without the UI, writing the answer to stdout and any
+errors to stderr. Text piped or redirected to stdin is sent along with the
+prompt:
+
+  prodterm ask "summarise my unread e-mails" > digest.md
+  git log v1.2.0.. | prodterm ask "write release notes"
+  prodterm ask "review this" < change.diff
+
+Only a pipe or a file is read; a terminal, socket or device such as
+/dev/null is left alone. Where stdin is a pipe that is never closed, as with
+ssh without -n, add < /dev/null so that ask does not wait for it.
+
+With --output json the result is written as a JSON object, including the
+provider data the answer was based on and the tokens used, and with
+--output jsonl as a stream of JSON events, one per line. Errors are then
+written as JSON too.
+
+The exit status is 0 on success, 1 if the request failed, 2 for a usage or
+configuration error, 3 if the answer was cut off by the token limit and
+130 if interrupted.`
+
+// Exit statuses of prodterm ask
+const (
+	exitOK          = 0
+	exitFailed      = 1
+	exitUsage       = 2
+	exitTruncated   = 3
+	exitInterrupted = 130
+)
+
+// Output formats of prodterm ask
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+)
+
+// maxAskInput bounds the text read from stdin, which is sent whole with
+// the prompt
+const maxAskInput = 1024 * 1024
+
+// runAsk runs the ask command and returns the exit code
+func runAsk(args []string) int {
+	fs := flag.NewFlagSet("ask", flag.ContinueOnError)
+	var flags config.Flags
+	flags.Register(fs)
+	format := fs.String("output", outputText, "output format: text, json, or jsonl for a stream of events")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, askUsage)
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	prompt := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if prompt == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	switch *format {
+	case outputText, outputJSON, outputJSONL:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %q: use text, json or jsonl\n", *format)
+		return exitUsage
+	}
+	out := &askWriter{format: *format, stdout: os.Stdout, stderr: os.Stderr}
+
+	// Read stdin before anything else can, such as a Gmail authorisation
+	// prompt
+	input, err := readAskInput(os.Stdin)
+	if err != nil {
+		return out.fail(exitUsage, fmt.Errorf("error reading stdin: %v", err))
+	}
+
+	cfg, err := config.LoadWithFlags(flags)
+	if err != nil {
+		return out.fail(exitUsage, fmt.Errorf("error loading config: %v", err))
+	}
+	// Only out writes to stdout, which may be parsed as JSON
+	cfg.Gmail.Prompt = out.stderr
+	transport, err := cassetteTransport(cfg)
+	if err != nil {
+		return out.fail(exitUsage, fmt.Errorf("error loading cassette: %v", err))
+	}
+
+	// Providers log their progress for the UI; only a failure that spoils
+	// the answer is worth reporting here
+	log.SetOutput(io.Discard)
+	warnings := initializeProviders(cfg, transport)
+	setCachePolicy(cfg)
+
+	var httpClient *http.Client
+	if transport != nil {
+		httpClient = transport.Client()
+	}
+	handler := handlers.NewHandlerWithHTTPClient(cfg, httpClient)
+	if input != "" {
+		handler.AttachText("stdin", input)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var result *handlers.Result
+	if out.format == outputJSONL {
+		result, err = handler.ProcessCommandEvents(ctx, prompt, out.event)
+	} else {
+		result, err = handler.ProcessCommand(ctx, prompt)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return out.fail(exitInterrupted, errors.New("interrupted"))
+		}
+		// Say why a provider the prompt needed could not be started
+		if errors.Is(err, mcp.ErrProviderNotFound) {
+			return out.fail(exitFailed, err, warnings...)
+		}
+		return out.fail(exitFailed, err)
+	}
+
+	out.result(result)
+	if result.Truncated {
+		return exitTruncated
+	}
+	return exitOK
+}
+
+// askWriter writes the outcome of prodterm ask in the chosen format
+type askWriter struct {
+	format string
+	stdout io.Writer
+	stderr io.Writer
+
+	// mutex keeps events whole, as sources may arrive from more than one
+	// goroutine
+	mutex sync.Mutex
+}
+
+// event writes an event as a line of JSON. An error is left for fail to
+// write, along with its hints.
+func (w *askWriter) event(event handlers.Event) {
+	if event.Type == handlers.EventError {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	json.NewEncoder(w.stdout).Encode(event)
+}
+
+// fail reports an error, with any hints that explain it, and returns code
+func (w *askWriter) fail(code int, err error, hints ...string) int {
+	message := err.Error()
+	switch w.format {
+	case outputJSON:
+		json.NewEncoder(w.stdout).Encode(struct {
+			Error string   `json:"error"`
+			Hints []string `json:"hints,omitempty"`
+		}{message, hints})
+	case outputJSONL:
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		json.NewEncoder(w.stdout).Encode(handlers.Event{
+			Type:  handlers.EventError,
+			Error: strings.Join(append([]string{message}, hints...), "\n"),
+		})
+	default:
+		fmt.Fprintf(w.stderr, "Error: %s\n", message)
+		for _, hint := range hints {
+			fmt.Fprintln(w.stderr, hint)
+		}
+	}
+	return code
+}
+
+// result writes the outcome of a command. The jsonl format has already
+// written it as an event.
+func (w *askWriter) result(result *handlers.Result) {
+	switch w.format {
+	case outputJSON:
+		encoder := json.NewEncoder(w.stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+	case outputJSONL:
+	default:
+		fmt.Fprintln(w.stdout, strings.TrimRight(result.Text, "\n"))
+		if triage := result.Triage(); triage != "" {
+			fmt.Fprintln(w.stdout)
+			fmt.Fprintln(w.stdout, strings.TrimRight(triage, "\n"))
+		}
+		for _, warning := range result.Warnings {
+			fmt.Fprintln(w.stderr, "Warning: "+warning)
+		}
+		if result.Truncated {
+			fmt.Fprintln(w.stderr, "The answer was cut off by the token limit. Raise CLAUDE_MAX_TOKENS or CLAUDE_MAX_CONTINUATIONS to get all of it.")
+		}
+	}
+}
+
+// readAskInput reads the text piped or redirected to stdin. Anything else,
+// such as a terminal or a socket kept open by a parent process, might never
+// reach end of file, so it is not read and an empty string is returned.
+func readAskInput(stdin *os.File) (string, error) {
+	info, err := stdin.Stat()
+	if err != nil {
+		return "", nil
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 && !info.Mode().IsRegular() {
+		return "", nil
+	}
+	data, err := io.ReadAll(io.LimitReader(stdin, maxAskInput+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxAskInput {
+		return "", errors.New("input is over the " + api.FormatSize(maxAskInput) + " limit")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
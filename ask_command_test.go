@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"terminal-claude/handlers"
+)
+
+// captureStdout runs f with stdout sent to a pipe, returning what was
+// written to it
+func captureStdout(t *testing.T, f func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	f()
+	w.Close()
+	return <-done
+}
+
+func TestAskJSONOutputParses(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, ".config"))
+	for _, name := range []string{"ANTHROPIC_BASE_URL", "LLM_BACKEND", "PRODTERM_CONFIG", "PRODTERM_RECORD"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-api03-replaying")
+	t.Setenv("PRODTERM_REPLAY", filepath.Join("cassette", "testdata", "ask.json"))
+
+	// Nothing is piped in
+	stdin := os.Stdin
+	empty, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+	os.Stdin = empty
+	defer func() { os.Stdin = stdin }()
+
+	var code int
+	output := captureStdout(t, func() {
+		code = runAsk([]string{"--output", "json", "what is a goroutine?"})
+	})
+	if code != exitOK {
+		t.Fatalf("exit code %d, output %s", code, output)
+	}
+
+	var result handlers.Result
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	if err := decoder.Decode(&result); err != nil {
+		t.Fatalf("stdout is not JSON: %v\n%s", err, output)
+	}
+	if decoder.More() {
+		t.Errorf("stdout has more than the result: %s", output)
+	}
+	if result.Text == "" {
+		t.Errorf("result has no text: %s", output)
+	}
+}
+
+func TestAskJSONLinesParse(t *testing.T) {
+	var stdout bytes.Buffer
+	w := &askWriter{format: outputJSONL, stdout: &stdout, stderr: io.Discard}
+	w.event(handlers.Event{Type: handlers.EventDelta, Delta: "half an\nanswer"})
+	w.event(handlers.Event{Type: handlers.EventError, Error: "left for fail"})
+	w.fail(exitFailed, errors.New("request failed"), "Gmail is unavailable")
+
+	var types []string
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		var event handlers.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line is not JSON: %v\n%s", err, scanner.Bytes())
+		}
+		types = append(types, event.Type)
+	}
+	if len(types) != 2 || types[0] != handlers.EventDelta || types[1] != handlers.EventError {
+		t.Errorf("event types = %q", types)
+	}
+}
+
+func TestReadAskInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "change.diff")
+	if err := os.WriteFile(path, []byte("+ added line\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if input, err := readAskInput(file); err != nil || input != "+ added line" {
+		t.Errorf("redirected file = %q, %v", input, err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.Write([]byte("piped text\n"))
+	w.Close()
+	if input, err := readAskInput(r); err != nil || input != "piped text" {
+		t.Errorf("pipe = %q, %v", input, err)
+	}
+
+	// A device is never read, so one that does not end cannot hang ask
+	zero, err := os.Open("/dev/zero")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer zero.Close()
+	if input, err := readAskInput(zero); err != nil || input != "" {
+		t.Errorf("device = %q, %v", input, err)
+	}
+}
@@ -0,0 +1,357 @@
+// Package batch runs bulk summarisation jobs through the Message Batches API.
+// Jobs are persisted locally so that they can be followed across restarts,
+// and polled until their results are ready.
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"terminal-claude/api"
+	"time"
+)
+
+// API is the part of api.Client that jobs are run through
+type API interface {
+	BatchRequest(customID string, chat api.ChatRequest) (api.BatchRequest, error)
+	CreateBatch(ctx context.Context, requests []api.BatchRequest) (*api.Batch, error)
+	GetBatch(ctx context.Context, id string) (*api.Batch, error)
+	CancelBatch(ctx context.Context, id string) (*api.Batch, error)
+	BatchResults(ctx context.Context, batch *api.Batch, task string) ([]api.BatchResult, error)
+}
+
+var _ API = (*api.Client)(nil)
+
+// Item is one prompt to include in a job
+type Item struct {
+	// ID identifies the item's result; see api.Client.BatchRequest
+	ID string
+
+	// Label is what the result is shown under, e.g. an email subject
+	Label  string
+	Prompt string
+}
+
+// Job is a submitted batch, as persisted to disk
+type Job struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Task      string            `json:"task"`
+	CreatedAt time.Time         `json:"created_at"`
+	Status    string            `json:"status"`
+	Counts    api.BatchCounts   `json:"counts"`
+	Labels    map[string]string `json:"labels"`
+
+	// Results are filled in once the batch has ended, ordered by label
+	Results []Result `json:"results,omitempty"`
+	Done    bool     `json:"done"`
+}
+
+// Result is the answer to one item of a job
+type Result struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Text  string `json:"text,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Total returns the number of items in the job
+func (j Job) Total() int {
+	return len(j.Labels)
+}
+
+// Progress describes how far the job has got
+func (j Job) Progress() string {
+	if j.Done {
+		failed := j.Counts.Errored + j.Counts.Canceled + j.Counts.Expired
+		if failed > 0 {
+			return fmt.Sprintf("finished, %d of %d succeeded", j.Counts.Succeeded, j.Total())
+		}
+		return fmt.Sprintf("finished, %d results", j.Counts.Succeeded)
+	}
+	finished := j.Total() - j.Counts.Processing
+	if j.Status == api.BatchCanceling {
+		return fmt.Sprintf("cancelling, %d of %d done", finished, j.Total())
+	}
+	return fmt.Sprintf("in progress, %d of %d done", finished, j.Total())
+}
+
+// Manager submits jobs and keeps track of them until their results are in
+type Manager struct {
+	api   API
+	dir   string
+	mutex sync.Mutex
+	jobs  map[string]*Job
+
+	// polling is held while a poll is running, so that overlapping polls
+	// cannot fetch and account for the same results twice
+	polling sync.Mutex
+}
+
+// NewManager creates a manager that persists jobs under dir, picking up any
+// jobs submitted earlier. An empty dir keeps jobs in memory only.
+func NewManager(api API, dir string) (*Manager, error) {
+	m := &Manager{api: api, dir: dir, jobs: map[string]*Job{}}
+	if dir == "" {
+		return m, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read batch job %s: %v", path, err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("invalid batch job file %s: %v", path, err)
+		}
+		m.jobs[job.ID] = &job
+	}
+	return m, nil
+}
+
+// Submit sends the items to be answered as one batch for a task, using
+// system as the system prompt when it is not empty
+func (m *Manager) Submit(ctx context.Context, name string, task string, system string, items []Item) (*Job, error) {
+	job := &Job{
+		Name:   name,
+		Task:   task,
+		Labels: make(map[string]string, len(items)),
+	}
+
+	requests := make([]api.BatchRequest, 0, len(items))
+	for _, item := range items {
+		if _, ok := job.Labels[item.ID]; ok {
+			return nil, fmt.Errorf("duplicate batch item %q", item.ID)
+		}
+		request, err := m.api.BatchRequest(item.ID, api.ChatRequest{Task: task, Prompt: item.Prompt, System: system})
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+		job.Labels[item.ID] = item.Label
+	}
+
+	batch, err := m.api.CreateBatch(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+	job.ID = batch.ID
+	job.CreatedAt = batch.CreatedAt
+	job.Status = batch.ProcessingStatus
+	job.Counts = batch.RequestCounts
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.jobs[job.ID] = job
+	if err := m.save(job); err != nil {
+		return nil, fmt.Errorf("batch %s was submitted but could not be saved: %v", job.ID, err)
+	}
+	return job, nil
+}
+
+// Jobs returns every known job, newest first
+func (m *Manager) Jobs() []Job {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Find returns the job with an id, or the job at a position in the list
+// returned by Jobs, counting from 1
+func (m *Manager) Find(ref string) (Job, bool) {
+	jobs := m.Jobs()
+	for _, job := range jobs {
+		if job.ID == ref {
+			return job, true
+		}
+	}
+
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(jobs) {
+		return jobs[n-1], true
+	}
+	return Job{}, false
+}
+
+// Pending returns how many jobs are still waiting for results
+func (m *Manager) Pending() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	pending := 0
+	for _, job := range m.jobs {
+		if !job.Done {
+			pending++
+		}
+	}
+	return pending
+}
+
+// Cancel asks for a job to stop. Items already answered still have results.
+func (m *Manager) Cancel(ctx context.Context, id string) error {
+	batch, err := m.api.CancelBatch(ctx, id)
+	if err != nil {
+		return err
+	}
+	return m.update(batch, nil)
+}
+
+// Forget removes a job from the local record
+func (m *Manager) Forget(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.jobs, id)
+	if m.dir == "" {
+		return nil
+	}
+	if err := os.Remove(m.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Poll checks every unfinished job once, fetching the results of those that
+// have ended, and returns the jobs that finished. Errors with one job do not
+// stop the others from being checked. A poll started while another is
+// running returns straight away.
+func (m *Manager) Poll(ctx context.Context) ([]Job, error) {
+	if !m.polling.TryLock() {
+		return nil, nil
+	}
+	defer m.polling.Unlock()
+
+	m.mutex.Lock()
+	var pending []Job
+	for _, job := range m.jobs {
+		if !job.Done {
+			pending = append(pending, *job)
+		}
+	}
+	m.mutex.Unlock()
+
+	var finished []Job
+	var errs []string
+	for _, job := range pending {
+		batch, err := m.api.GetBatch(ctx, job.ID)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", job.Name, err))
+			continue
+		}
+
+		var results []api.BatchResult
+		if batch.ProcessingStatus == api.BatchEnded {
+			results, err = m.api.BatchResults(ctx, batch, job.Task)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", job.Name, err))
+				continue
+			}
+			if results == nil {
+				results = []api.BatchResult{}
+			}
+		}
+
+		if err := m.update(batch, results); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", job.Name, err))
+		}
+		if results != nil {
+			if done, ok := m.Find(job.ID); ok {
+				finished = append(finished, done)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return finished, fmt.Errorf("unable to check batches: %s", strings.Join(errs, "; "))
+	}
+	return finished, nil
+}
+
+// update records the latest state of a batch, and its results once it has
+// ended
+func (m *Manager) update(batch *api.Batch, results []api.BatchResult) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	job, ok := m.jobs[batch.ID]
+	if !ok {
+		return fmt.Errorf("unknown batch %s", batch.ID)
+	}
+	job.Status = batch.ProcessingStatus
+	job.Counts = batch.RequestCounts
+
+	if results != nil {
+		job.Results = toResults(job, results)
+		job.Done = true
+	}
+	return m.save(job)
+}
+
+// toResults pairs results with their labels, in a stable order
+func toResults(job *Job, results []api.BatchResult) []Result {
+	converted := make([]Result, 0, len(results))
+	for _, result := range results {
+		r := Result{
+			ID:    result.CustomID,
+			Label: job.Labels[result.CustomID],
+			Text:  result.Text(),
+		}
+		if err := result.Err(); err != nil {
+			r.Error = err.Error()
+		}
+		converted = append(converted, r)
+	}
+	sort.SliceStable(converted, func(i, j int) bool {
+		return converted[i].Label < converted[j].Label
+	})
+	return converted
+}
+
+// save writes a job to disk. The caller holds the mutex.
+func (m *Manager) save(job *Job) error {
+	if m.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash cannot leave a partial record
+	path := m.path(job.ID)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// path returns the file a job is kept in
+func (m *Manager) path(id string) string {
+	return filepath.Join(m.dir, filepath.Base(id)+".json")
+}
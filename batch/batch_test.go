@@ -0,0 +1,238 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"terminal-claude/api"
+	"terminal-claude/config"
+)
+
+// batchServer stands in for the Message Batches API, holding one batch at a
+// time that stays in progress until end is called
+type batchServer struct {
+	*httptest.Server
+
+	mutex     sync.Mutex
+	customIDs []string
+	ended     bool
+	cancelled bool
+}
+
+func newBatchServer(t *testing.T) *batchServer {
+	s := &batchServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/messages/batches", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Requests []api.BatchRequest `json:"requests"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mutex.Lock()
+		s.customIDs = nil
+		for _, request := range body.Requests {
+			s.customIDs = append(s.customIDs, request.CustomID)
+		}
+		s.mutex.Unlock()
+		s.writeBatch(w)
+	})
+	mux.HandleFunc("GET /v1/messages/batches/msgbatch_1", func(w http.ResponseWriter, r *http.Request) {
+		s.writeBatch(w)
+	})
+	mux.HandleFunc("POST /v1/messages/batches/msgbatch_1/cancel", func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		s.cancelled = true
+		s.mutex.Unlock()
+		s.writeBatch(w)
+	})
+	mux.HandleFunc("GET /v1/messages/batches/msgbatch_1/results", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "test-key" {
+			http.Error(w, "missing key", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintln(w, `{"custom_id":"email-1","result":{"type":"succeeded","message":{"id":"m1","type":"message","role":"assistant","model":"claude-3-haiku-20240307","content":[{"type":"text","text":"Lunch is moved to Friday."}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":6}}}}`)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, `{"custom_id":"email-2","result":{"type":"errored","error":{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}}}`)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// end finishes the batch, so that its results can be fetched
+func (s *batchServer) end() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ended = true
+}
+
+// writeBatch reports the batch in its current state
+func (s *batchServer) writeBatch(w http.ResponseWriter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	batch := map[string]interface{}{
+		"id":                "msgbatch_1",
+		"processing_status": api.BatchInProgress,
+		"request_counts":    map[string]int{"processing": 2},
+		"created_at":        "2024-09-24T18:37:24Z",
+	}
+	switch {
+	case s.ended:
+		batch["processing_status"] = api.BatchEnded
+		batch["request_counts"] = map[string]int{"succeeded": 1, "errored": 1}
+		batch["results_url"] = s.URL + "/v1/messages/batches/msgbatch_1/results"
+	case s.cancelled:
+		batch["processing_status"] = api.BatchCanceling
+	}
+	json.NewEncoder(w).Encode(batch)
+}
+
+// newClient returns a client for the stand-in server
+func newClient(s *batchServer) *api.Client {
+	return api.NewClient(config.Config{
+		Backend:          config.BackendAnthropic,
+		AnthropicAPIKey:  "test-key",
+		AnthropicBaseURL: s.URL,
+		Model:            config.SmallModel,
+		MaxTokens:        config.DefaultMaxTokens,
+	})
+}
+
+// items are the prompts submitted by the tests
+var items = []Item{
+	{ID: "email-2", Label: "Quarterly report", Prompt: "Summarise the quarterly report email"},
+	{ID: "email-1", Label: "Lunch", Prompt: "Summarise the lunch email"},
+}
+
+func TestSubmitPollAndResults(t *testing.T) {
+	server := newBatchServer(t)
+	dir := t.TempDir()
+	manager, err := NewManager(newClient(server), dir)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	ctx := context.Background()
+
+	job, err := manager.Submit(ctx, "2 emails", api.TaskEmail, "", items)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if job.ID != "msgbatch_1" || job.Status != api.BatchInProgress {
+		t.Errorf("job = %+v", job)
+	}
+	if got := strings.Join(server.customIDs, ","); got != "email-2,email-1" {
+		t.Errorf("submitted custom ids %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "msgbatch_1.json")); err != nil {
+		t.Errorf("job was not saved: %v", err)
+	}
+
+	finished, err := manager.Poll(ctx)
+	if err != nil || len(finished) != 0 {
+		t.Fatalf("Poll before the batch ended = %v, %v", finished, err)
+	}
+	if manager.Pending() != 1 {
+		t.Errorf("%d pending, want 1", manager.Pending())
+	}
+
+	server.end()
+	finished, err = manager.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if len(finished) != 1 || !finished[0].Done {
+		t.Fatalf("finished = %+v", finished)
+	}
+	results := finished[0].Results
+	if len(results) != 2 {
+		t.Fatalf("%d results, want 2", len(results))
+	}
+	if results[0].Label != "Lunch" || results[0].Text != "Lunch is moved to Friday." || results[0].Error != "" {
+		t.Errorf("first result = %+v", results[0])
+	}
+	if results[1].Label != "Quarterly report" || !strings.Contains(results[1].Error, "overloaded_error") {
+		t.Errorf("second result = %+v", results[1])
+	}
+	if manager.Pending() != 0 {
+		t.Errorf("%d pending after the batch ended", manager.Pending())
+	}
+}
+
+func TestResumeSavedJobAfterRestart(t *testing.T) {
+	server := newBatchServer(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	first, err := NewManager(newClient(server), dir)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if _, err := first.Submit(ctx, "2 emails", api.TaskEmail, "", items); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	// A new manager, as after a restart, picks the job up from disk
+	restarted, err := NewManager(newClient(server), dir)
+	if err != nil {
+		t.Fatalf("NewManager after restart: %v", err)
+	}
+	job, ok := restarted.Find("1")
+	if !ok || job.ID != "msgbatch_1" || job.Labels["email-1"] != "Lunch" {
+		t.Fatalf("saved job = %+v, %v", job, ok)
+	}
+	if restarted.Pending() != 1 {
+		t.Errorf("%d pending, want 1", restarted.Pending())
+	}
+
+	server.end()
+	finished, err := restarted.Poll(ctx)
+	if err != nil || len(finished) != 1 {
+		t.Fatalf("Poll = %v, %v", finished, err)
+	}
+	if finished[0].Results[0].Label != "Lunch" {
+		t.Errorf("results = %+v", finished[0].Results)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	server := newBatchServer(t)
+	manager, err := NewManager(newClient(server), "")
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := manager.Submit(ctx, "2 emails", api.TaskEmail, "", items); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	if err := manager.Cancel(ctx, "msgbatch_1"); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	job, _ := manager.Find("msgbatch_1")
+	if job.Status != api.BatchCanceling {
+		t.Errorf("status = %s, want %s", job.Status, api.BatchCanceling)
+	}
+}
+
+func TestNewManagerReportsUnreadableJob(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "msgbatch_1.json"), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewManager(newClient(newBatchServer(t)), dir)
+	if err == nil || !strings.Contains(err.Error(), "msgbatch_1.json") {
+		t.Errorf("err = %v, want one naming the bad file", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Package cache keeps answers on disk for a limited time, so that asking the
+// same thing again shortly afterwards does not cost another API call.
+// Entries expire after the store's TTL, and the least recently used entries
+// are evicted once the store grows beyond its size limit.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// entry is a cached value, as stored on disk
+type entry struct {
+	StoredAt  time.Time       `json:"stored_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Store is a directory of cached values
+type Store struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+	mutex    sync.Mutex
+}
+
+// Stats describes what a store holds
+type Stats struct {
+	Entries int
+	Bytes   int64
+}
+
+// New creates a store that keeps values under dir for ttl, using at most
+// maxBytes of disk. A maxBytes of zero or less means no size limit.
+func New(dir string, ttl time.Duration, maxBytes int64) *Store {
+	return &Store{dir: dir, ttl: ttl, maxBytes: maxBytes}
+}
+
+// TTL returns how long values are kept
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Key derives a cache key from any values that can be encoded as JSON. Maps
+// are encoded with sorted keys, so equal values always give the same key.
+func Key(parts ...interface{}) (string, error) {
+	data, err := json.Marshal(parts)
+	if err != nil {
+		return "", fmt.Errorf("unable to derive cache key: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Get decodes the value stored under key into out, reporting whether there
+// was an unexpired value to decode
+func (s *Store) Get(key string, out interface{}) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := s.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil || time.Now().After(e.ExpiresAt) {
+		os.Remove(path)
+		return false
+	}
+	if err := json.Unmarshal(e.Data, out); err != nil {
+		os.Remove(path)
+		return false
+	}
+
+	// Note the use, so that eviction removes the least recently used first
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return true
+}
+
+// Put stores value under key, evicting the least recently used values if the
+// store has grown beyond its size limit
+func (s *Store) Put(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	encoded, err := json.Marshal(entry{StoredAt: now, ExpiresAt: now.Add(s.ttl), Data: data})
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash cannot leave a partial entry
+	path := s.path(key)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, encoded, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return s.evict()
+}
+
+// Clear removes every value from the store and returns how many there were
+func (s *Store) Clear() (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, file := range files {
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Stats returns how many values the store holds and how much disk they use,
+// including any that have expired but not yet been removed
+func (s *Store) Stats() (Stats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{Entries: len(files)}
+	for _, file := range files {
+		stats.Bytes += file.size
+	}
+	return stats, nil
+}
+
+// evict removes expired values, then the least recently used ones until the
+// store is within its size limit. The caller holds the mutex.
+func (s *Store) evict() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	// A value last used longer than the TTL ago was stored even earlier, so
+	// it has expired without needing to be read
+	var total int64
+	var kept []cacheFile
+	for _, file := range files {
+		if time.Since(file.modified) > s.ttl {
+			os.Remove(file.path)
+			continue
+		}
+		total += file.size
+		kept = append(kept, file)
+	}
+
+	if s.maxBytes <= 0 {
+		return nil
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].modified.Before(kept[j].modified)
+	})
+	for _, file := range kept {
+		if total <= s.maxBytes {
+			break
+		}
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= file.size
+	}
+	return nil
+}
+
+// cacheFile is a stored value as found on disk
+type cacheFile struct {
+	path     string
+	size     int64
+	modified time.Time
+}
+
+// files lists the values in the store. The caller holds the mutex.
+func (s *Store) files() ([]cacheFile, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []cacheFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cacheFile{
+			path:     filepath.Join(s.dir, e.Name()),
+			size:     info.Size(),
+			modified: info.ModTime(),
+		})
+	}
+	return files, nil
+}
+
+// path returns the file a value is kept in
+func (s *Store) path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(key)+".json")
+}
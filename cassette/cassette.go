@@ -0,0 +1,198 @@
+// Package cassette records HTTP exchanges to a file and replays them later,
+// so that the Claude client and the Gmail and Slack providers can be run
+// offline and deterministically. Secrets are scrubbed before anything is
+// written to disk.
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// Interaction is one recorded request and the response it received
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    Body        `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is a request or response body. Text is kept readable in the
+// cassette; anything else is stored as base64.
+type Body []byte
+
+// MarshalJSON stores text as a string and binary data as {"base64": "..."}
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON reads a body stored by MarshalJSON
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = Body(text)
+		return nil
+	}
+
+	var encoded map[string]string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return fmt.Errorf("body must be a string or {\"base64\": ...}")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded["base64"])
+	if err != nil {
+		return fmt.Errorf("invalid base64 body: %v", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// Cassette is a file of recorded interactions
+type Cassette struct {
+	path         string
+	mutex        sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// New creates an empty cassette that is saved to path
+func New(path string) *Cassette {
+	return &Cassette{path: path}
+}
+
+// Load reads a cassette recorded earlier
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cassette: %v", err)
+	}
+
+	var file struct {
+		Interactions []Interaction `json:"interactions"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %v", filepath.Base(path), err)
+	}
+
+	return &Cassette{
+		path:         path,
+		interactions: file.Interactions,
+		used:         make([]bool, len(file.Interactions)),
+	}, nil
+}
+
+// Interactions returns the recorded interactions
+func (c *Cassette) Interactions() []Interaction {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// Unused returns how many interactions have not been replayed yet
+func (c *Cassette) Unused() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	unused := 0
+	for _, used := range c.used {
+		if !used {
+			unused++
+		}
+	}
+	return unused
+}
+
+// add records an interaction and saves the cassette, so that a session that
+// ends abruptly still leaves everything recorded so far
+func (c *Cassette) add(interaction Interaction) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.interactions = append(c.interactions, interaction)
+	c.used = append(c.used, true)
+	return c.save()
+}
+
+// match finds the first unused interaction for a request, preferring one
+// whose body is identical, and marks it used. Requests are otherwise
+// matched on method and URL alone, in the order they were recorded, as
+// bodies often contain timestamps.
+func (c *Cassette) match(method string, url string, body []byte) (Interaction, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	candidate := -1
+	for i, interaction := range c.interactions {
+		if c.used[i] || interaction.Request.Method != method || interaction.Request.URL != url {
+			continue
+		}
+		if bytes.Equal(interaction.Request.Body, body) {
+			candidate = i
+			break
+		}
+		if candidate < 0 {
+			candidate = i
+		}
+	}
+
+	if candidate < 0 {
+		return Interaction{}, false
+	}
+	c.used[candidate] = true
+	return c.interactions[candidate], true
+}
+
+// save writes the cassette to disk. The caller holds the mutex.
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(map[string]interface{}{"interactions": c.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash cannot leave a partial record
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.path)
+}
+
+// readBody reads a response body and replaces it so that it can be read again
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
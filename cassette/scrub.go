@@ -0,0 +1,144 @@
+package cassette
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redacted replaces every scrubbed secret
+const redacted = "REDACTED"
+
+// secretHeaders are never recorded as sent
+var secretHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"X-Api-Key",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// secretParams are query, form and JSON fields that hold credentials
+var secretParams = []string{
+	"token",
+	"access_token",
+	"refresh_token",
+	"id_token",
+	"client_secret",
+	"code",
+	"key",
+	"api_key",
+}
+
+// secretPatterns match credentials wherever they appear
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-ant-[A-Za-z0-9_-]+`),     // Anthropic API keys
+	regexp.MustCompile(`xox[abposr]-[A-Za-z0-9-]+`), // Slack tokens
+	regexp.MustCompile(`ya29\.[A-Za-z0-9_.-]+`),     // Google access tokens
+	regexp.MustCompile(`1//[A-Za-z0-9_-]{20,}`),     // Google refresh tokens
+	regexp.MustCompile(`GOCSPX-[A-Za-z0-9_-]+`),     // Google client secrets
+}
+
+// Scrubber removes secrets from exchanges before they are recorded
+type Scrubber struct {
+	secrets    []string
+	jsonFields *regexp.Regexp
+	formFields *regexp.Regexp
+}
+
+// NewScrubber creates a scrubber for the usual credential headers, fields
+// and token formats, plus any literal secrets given, such as API keys read
+// from the configuration
+func NewScrubber(secrets ...string) *Scrubber {
+	s := &Scrubber{}
+	for _, secret := range secrets {
+		if len(secret) >= 8 {
+			s.secrets = append(s.secrets, secret)
+		}
+	}
+	// Replace longer secrets first in case one contains another
+	sort.Slice(s.secrets, func(i, j int) bool { return len(s.secrets[i]) > len(s.secrets[j]) })
+
+	names := strings.Join(secretParams, "|")
+	s.jsonFields = regexp.MustCompile(`("(?:` + names + `)"\s*:\s*)"[^"]*"`)
+	s.formFields = regexp.MustCompile(`(^|&)((?:` + names + `)=)[^&]*`)
+	return s
+}
+
+// Request returns a request as it should be recorded
+func (s *Scrubber) Request(req *http.Request, body []byte) Request {
+	return Request{
+		Method:  req.Method,
+		URL:     s.URL(req.URL),
+		Headers: s.Headers(req.Header),
+		Body:    s.Body(body),
+	}
+}
+
+// Response returns a response as it should be recorded
+func (s *Scrubber) Response(resp *http.Response, body []byte) Response {
+	return Response{
+		StatusCode: resp.StatusCode,
+		Headers:    s.Headers(resp.Header),
+		Body:       s.Body(body),
+	}
+}
+
+// URL returns a URL with secret query parameters redacted
+func (s *Scrubber) URL(u *url.URL) string {
+	scrubbed := *u
+	scrubbed.User = nil
+
+	query := scrubbed.Query()
+	for _, name := range secretParams {
+		if query.Has(name) {
+			query.Set(name, redacted)
+		}
+	}
+	scrubbed.RawQuery = query.Encode()
+	return s.Text(scrubbed.String())
+}
+
+// Headers returns a copy of headers with credentials redacted
+func (s *Scrubber) Headers(headers http.Header) http.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	scrubbed := make(http.Header, len(headers))
+	for name, values := range headers {
+		scrubbed[name] = make([]string, len(values))
+		for i, value := range values {
+			scrubbed[name][i] = s.Text(value)
+		}
+	}
+	for _, name := range secretHeaders {
+		if scrubbed.Get(name) != "" {
+			scrubbed.Set(name, redacted)
+		}
+	}
+	return scrubbed
+}
+
+// Body returns a body with secret fields and tokens redacted
+func (s *Scrubber) Body(body []byte) Body {
+	if body == nil {
+		return nil
+	}
+	text := s.jsonFields.ReplaceAllString(string(body), `${1}"`+redacted+`"`)
+	text = s.formFields.ReplaceAllString(text, "${1}${2}"+redacted)
+	return Body(s.Text(text))
+}
+
+// Text redacts known secrets and token formats from text
+func (s *Scrubber) Text(text string) string {
+	for _, secret := range s.secrets {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllString(text, redacted)
+	}
+	return text
+}
@@ -0,0 +1,150 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Mode selects whether a Transport records or replays
+type Mode int
+
+const (
+	// Record sends requests on and saves each exchange to the cassette
+	Record Mode = iota
+
+	// Replay answers requests from the cassette without any network access
+	Replay
+)
+
+// Transport is an http.RoundTripper that records exchanges to a cassette or
+// replays them from one. Recording reads each response in full before
+// returning it, so streamed responses arrive all at once.
+type Transport struct {
+	Mode     Mode
+	Cassette *Cassette
+
+	// Base sends requests when recording; nil means http.DefaultTransport
+	Base http.RoundTripper
+
+	// Scrubber removes secrets before anything is recorded. Requests being
+	// replayed are scrubbed the same way before they are matched.
+	Scrubber *Scrubber
+}
+
+// NewRecorder creates a transport that records to a new cassette at path,
+// sending requests on through base
+func NewRecorder(path string, base http.RoundTripper, secrets ...string) *Transport {
+	return &Transport{
+		Mode:     Record,
+		Cassette: New(path),
+		Base:     base,
+		Scrubber: NewScrubber(secrets...),
+	}
+}
+
+// NewReplayer creates a transport that replays the cassette at path
+func NewReplayer(path string, secrets ...string) (*Transport, error) {
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Transport{
+		Mode:     Replay,
+		Cassette: c,
+		Scrubber: NewScrubber(secrets...),
+	}, nil
+}
+
+// Client returns an HTTP client that sends its requests through the transport
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip records or replays a single exchange
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Take a copy of the body, sending a clone of the request with the copy
+	// as round trippers must not modify the request they are given
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cassette: unable to read request body: %v", err)
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	recorded := t.scrubber().Request(req, body)
+
+	if t.Mode == Replay {
+		return t.replay(req, recorded)
+	}
+	return t.record(req, recorded)
+}
+
+// record sends a request on and saves the exchange
+func (t *Transport) record(req *http.Request, recorded Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: unable to read response body: %v", err)
+	}
+
+	interaction := Interaction{
+		Request:  recorded,
+		Response: t.scrubber().Response(resp, body),
+	}
+	if err := t.Cassette.add(interaction); err != nil {
+		return nil, fmt.Errorf("cassette: unable to save: %v", err)
+	}
+	return resp, nil
+}
+
+// replay answers a request from the cassette
+func (t *Transport) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	interaction, ok := t.Cassette.match(recorded.Method, recorded.URL, recorded.Body)
+	if !ok {
+		return nil, fmt.Errorf("cassette: no recorded response for %s %s", recorded.Method, recorded.URL)
+	}
+
+	response := interaction.Response
+	header := response.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(response.Body)))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", response.StatusCode, http.StatusText(response.StatusCode)),
+		StatusCode:    response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(response.Body)),
+		ContentLength: int64(len(response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// scrubber returns the transport's scrubber, or one for the usual secrets
+func (t *Transport) scrubber() *Scrubber {
+	if t.Scrubber == nil {
+		return NewScrubber()
+	}
+	return t.Scrubber
+}
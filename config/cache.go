@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for the response cache, once it is enabled
+const (
+	DefaultCacheTTL         = 15 * time.Minute
+	DefaultCacheMaxBytes    = 100 << 20
+	DefaultProviderCacheTTL = 2 * time.Minute
+)
+
+// Cache configures the opt-in on-disk cache of Claude's answers and the
+// in-memory cache of provider results
+type Cache struct {
+	// Enabled turns both caches on
+	Enabled bool
+
+	// TTL is how long an answer is reused for
+	TTL time.Duration
+
+	// MaxBytes bounds the disk used by cached answers
+	MaxBytes int64
+
+	// ProviderTTL is how long provider results are reused for; zero means
+	// they are always fetched afresh
+	ProviderTTL time.Duration
+
+	// ProviderTTLs override ProviderTTL for a provider or one of its
+	// commands, keyed by lower case "<provider>" or "<provider>_<command>"
+	// (e.g. "slack" or "gmail_list_unread")
+	ProviderTTLs map[string]time.Duration
+}
+
+// ProviderTTLFor returns how long the results of a provider command are
+// reused for, or zero if they are not cached
+func (c Cache) ProviderTTLFor(provider string, command string) time.Duration {
+	if !c.Enabled {
+		return 0
+	}
+	provider = strings.ToLower(provider)
+	if ttl, ok := c.ProviderTTLs[provider+"_"+strings.ToLower(command)]; ok {
+		return ttl
+	}
+	if ttl, ok := c.ProviderTTLs[provider]; ok {
+		return ttl
+	}
+	return c.ProviderTTL
+}
+
+// loadCache reads the cache settings from the cache section of the config
+// file and then the environment: CLAUDE_RESPONSE_CACHE turns caching on,
+// CLAUDE_RESPONSE_CACHE_TTL and CLAUDE_RESPONSE_CACHE_MAX_MB bound the cached
+// answers, and CLAUDE_PROVIDER_CACHE_TTL and
+// CLAUDE_PROVIDER_CACHE_TTL_<PROVIDER>[_<COMMAND>] set how long provider
+// results are kept
+func loadCache(file *configFile) (Cache, error) {
+	cache := Cache{
+		TTL:          DefaultCacheTTL,
+		MaxBytes:     DefaultCacheMaxBytes,
+		ProviderTTL:  DefaultProviderCacheTTL,
+		ProviderTTLs: map[string]time.Duration{},
+	}
+
+	if file.Cache.Enabled != nil {
+		cache.Enabled = *file.Cache.Enabled
+	}
+	if file.Cache.TTL != nil {
+		cache.TTL = *file.Cache.TTL
+	}
+	if file.Cache.MaxMB != nil {
+		cache.MaxBytes = int64(*file.Cache.MaxMB) << 20
+	}
+	if file.Cache.ProviderTTL != nil {
+		cache.ProviderTTL = *file.Cache.ProviderTTL
+	}
+	for key, ttl := range file.Cache.ProviderTTLs {
+		cache.ProviderTTLs[strings.ToLower(key)] = ttl
+	}
+
+	switch value := strings.ToLower(os.Getenv("CLAUDE_RESPONSE_CACHE")); value {
+	case "":
+	case "0", "false", "off", "no":
+		cache.Enabled = false
+	case "1", "true", "on", "yes":
+		cache.Enabled = true
+	default:
+		return Cache{}, fmt.Errorf("CLAUDE_RESPONSE_CACHE must be on or off, got %q", value)
+	}
+
+	if value := os.Getenv("CLAUDE_RESPONSE_CACHE_TTL"); value != "" {
+		ttl, err := parseCacheTTL("CLAUDE_RESPONSE_CACHE_TTL", value)
+		if err != nil {
+			return Cache{}, err
+		}
+		cache.TTL = ttl
+	}
+
+	if value := os.Getenv("CLAUDE_RESPONSE_CACHE_MAX_MB"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return Cache{}, fmt.Errorf("CLAUDE_RESPONSE_CACHE_MAX_MB must be a positive number, got %q", value)
+		}
+		cache.MaxBytes = int64(n) << 20
+	}
+
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if value == "" || !strings.HasPrefix(name, "CLAUDE_PROVIDER_CACHE_TTL") {
+			continue
+		}
+
+		ttl, err := parseCacheTTL(name, value)
+		if err != nil {
+			return Cache{}, err
+		}
+		if name == "CLAUDE_PROVIDER_CACHE_TTL" {
+			cache.ProviderTTL = ttl
+		} else if key, ok := strings.CutPrefix(name, "CLAUDE_PROVIDER_CACHE_TTL_"); ok {
+			cache.ProviderTTLs[strings.ToLower(key)] = ttl
+		}
+	}
+
+	return cache, nil
+}
+
+// parseCacheTTL validates a cache lifetime such as "10m", where zero turns
+// that cache off
+func parseCacheTTL(name string, value string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("%s must be a duration such as 90s or 10m, got %q", name, value)
+	}
+	return ttl, nil
+}
@@ -2,32 +2,501 @@ package config
 
 import (
 	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"terminal-claude/secrets"
 )
 
+// SmallModel is the inexpensive model used by default for bulk tasks
+const SmallModel = "claude-3-haiku-20240307"
+
+// DefaultMaxTokens is the response length used when none is configured
+const DefaultMaxTokens = 1024
+
+// DefaultMaxContinuations is how many times a response cut off by the token
+// limit is continued by default
+const DefaultMaxContinuations = 3
+
+// MinThinkingBudget is the smallest thinking budget the API accepts
+const MinThinkingBudget = 1024
+
+// Backends that requests can be sent to
+const (
+	BackendAnthropic = "anthropic"
+	BackendOpenAI    = "openai"
+)
+
+// DefaultAnthropicBaseURL is where the Anthropic API is served
+const DefaultAnthropicBaseURL = "https://api.anthropic.com"
+
+// DefaultOpenAIBaseURL is where an OpenAI-compatible server is expected by
+// default: a local Ollama instance
+const DefaultOpenAIBaseURL = "http://localhost:11434/v1"
+
+// ErrNoAPIKey is returned when no Anthropic API key is configured. The rest
+// of the configuration is returned along with it, so that it can still be
+// inspected, as prodterm doctor does.
+var ErrNoAPIKey = errors.New("ANTHROPIC_API_KEY environment variable not set, nor anthropic.api_key in the config file, " +
+	"nor anthropic_api_key in the secret store (prodterm secrets set anthropic_api_key)")
+
 // Config holds application configuration
 type Config struct {
+	// Backend selects the API requests are sent to: BackendAnthropic, or
+	// BackendOpenAI for any OpenAI-compatible server such as Ollama or llama.cpp
+	Backend string
+	
 	AnthropicAPIKey string
-	Model           string
+	
+	// AnthropicBaseURL is where Anthropic API requests are sent; change it
+	// to point at a proxy or a local stand-in for tests
+	AnthropicBaseURL string
+	
+	OpenAIBaseURL   string
+	OpenAIAPIKey    string
+	
+	Model     string
+	MaxTokens int
+	
+	// MaxContinuations bounds how many follow-up requests are made to finish
+	// a response that hit MaxTokens; zero disables continuation
+	MaxContinuations int
+	
+	// PromptCaching marks stable request prefixes, such as the system prompt
+	// and fetched provider data, for the API to cache between requests
+	PromptCaching bool
+	
+	// ThinkingBudget, when positive, enables extended thinking with up to
+	// this many tokens of reasoning on top of MaxTokens
+	ThinkingBudget int
+	
+	// Routes override the model and response length for particular tasks,
+	// keyed by task name (e.g. "chat", "email", "slack", "webpage")
+	Routes map[string]Route
+	
+	// Prompts configures the system prompt, per-task overrides and personas
+	Prompts Prompts
+	
+	// Cache configures reuse of recent answers and provider results
+	Cache Cache
+	
+	// Gmail and Slack configure the providers
+	Gmail Gmail
+	Slack Slack
+	
+	// Path is the config file that was read, or would have been had it
+	// existed
+	Path string
+	
+	// Profile is the profile in use, or an empty string for the default
+	// profile, and Profiles lists the profiles in the config file
+	Profile  string
+	Profiles []string
+	
+	// DataDir is where the profile keeps its usage, batches and cached
+	// answers; empty when there is nowhere to keep them
+	DataDir string
+	
+	// Secrets is the encrypted vault of API keys and tokens
+	Secrets *secrets.Vault
+}
+
+// Route selects the model and response length used for one kind of task.
+// Zero fields fall back to the top-level Config values.
+type Route struct {
+	Model          string
+	MaxTokens      int
+	ThinkingBudget int
+}
+
+// Gmail configures the Gmail provider
+type Gmail struct {
+	// Credentials is the OAuth client file downloaded from Google Cloud
+	Credentials string
+	
+	// Token is the plain text file the OAuth token used to be kept in. A
+	// token found there is moved into Secrets.
+	Token string
+	
+	// Secrets keeps the OAuth token once access has been granted, under
+	// the name TokenSecret
+	Secrets     *secrets.Vault
+	TokenSecret string
+	
+	// Prompt is where the link to grant access is shown when there is no
+	// token yet; nil means stderr
+	Prompt io.Writer
+}
+
+// Slack configures the Slack provider
+type Slack struct {
+	// Token is the Slack API token; when empty it is looked up in Secrets
+	// under the name TokenSecret, and then read from the plain text file at
+	// TokenPath
+	Token       string
+	TokenPath   string
+	Secrets     *secrets.Vault
+	TokenSecret string
+}
+
+// Dir returns the directory prodterm keeps its local files in
+func Dir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".config", "terminal-claude"), nil
+}
+
+// Flags are settings given on the command line, which take precedence over
+// environment variables and the config file. Empty fields are unset.
+type Flags struct {
+	// ConfigPath is the config file to read instead of the default
+	ConfigPath string
+	
+	Backend   string
+	Model     string
+	MaxTokens int
+	Persona   string
+	Profile   string
+}
+
+// Register defines the flags on fs
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.ConfigPath, "config", "", "config file to read (default ~/.config/terminal-claude/config.yaml or $PRODTERM_CONFIG)")
+	fs.StringVar(&f.Backend, "backend", "", "API to send requests to: anthropic or openai")
+	fs.StringVar(&f.Model, "model", "", "model to use for tasks without a model of their own")
+	fs.IntVar(&f.MaxTokens, "max-tokens", 0, "maximum response length in tokens")
+	fs.StringVar(&f.Persona, "persona", "", "persona to start with")
+	fs.StringVar(&f.Profile, "profile", "", "profile from the config file to use (default $PRODTERM_PROFILE)")
 }
 
-// Load configuration from environment variables
+// FilePath returns the config file to read: the one named by the --config
+// flag or PRODTERM_CONFIG, which must exist, or else config.yaml in Dir,
+// which is optional
+func FilePath(flags Flags) (string, bool) {
+	if flags.ConfigPath != "" {
+		return expandHome(flags.ConfigPath), true
+	}
+	if path := os.Getenv("PRODTERM_CONFIG"); path != "" {
+		return expandHome(path), true
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(dir, FileName), false
+}
+
+// Load reads the configuration without any command line flags
 func Load() (Config, error) {
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		return Config{}, errors.New("ANTHROPIC_API_KEY environment variable not set")
+	return LoadWithFlags(Flags{})
+}
+
+// LoadWithFlags reads the configuration. Each setting is taken from the
+// first of the flags, environment variables, the selected profile, the rest
+// of the config file and the defaults that sets it.
+func LoadWithFlags(flags Flags) (Config, error) {
+	// Secrets not given anywhere else are looked up in the encrypted vault
+	return LoadWithSecrets(flags, OpenSecrets())
+}
+
+// LoadWithSecrets reads the configuration like LoadWithFlags, looking up
+// secrets in vault, so that a vault already unlocked is not asked for its
+// passphrase again when switching profiles
+func LoadWithSecrets(flags Flags, vault *secrets.Vault) (Config, error) {
+	path, required := FilePath(flags)
+	file, err := readConfigFile(path, required)
+	if err != nil {
+		return Config{}, err
+	}
+	
+	profile, err := file.selectProfile(flags.Profile)
+	if err != nil {
+		return Config{}, err
 	}
+	dataDir, _ := ProfileDir(profile)
 	
-	model := os.Getenv("CLAUDE_MODEL")
-	if model == "" {
-		model = "claude-3-sonnet-20240229" // Standard model name without suffix
+	if flags.Backend != "" && flags.Backend != BackendAnthropic && flags.Backend != BackendOpenAI {
+		return Config{}, fmt.Errorf("--backend must be %q or %q, got %q", BackendAnthropic, BackendOpenAI, flags.Backend)
 	}
+	backend := firstOf(flags.Backend, os.Getenv("LLM_BACKEND"), file.Backend, BackendAnthropic)
 	
-	// Print the model being used for debugging
-	println("Using Claude model:", model)
+	cfg := Config{
+		Backend:  backend,
+		Path:     path,
+		Profile:  profile,
+		Profiles: file.profileNames(),
+		DataDir:  dataDir,
+		Secrets:  vault,
+	}
+	var noAPIKey error
+	switch backend {
+	case BackendAnthropic:
+		cfg.AnthropicAPIKey = firstOf(os.Getenv("ANTHROPIC_API_KEY"), file.Anthropic.APIKey)
+		if cfg.AnthropicAPIKey == "" {
+			key, err := anthropicAPIKey(vault, profile)
+			if errors.Is(err, ErrNoAPIKey) {
+				noAPIKey = err
+			} else if err != nil {
+				return Config{}, err
+			}
+			cfg.AnthropicAPIKey = key
+		}
+		
+		cfg.AnthropicBaseURL = firstOf(os.Getenv("ANTHROPIC_BASE_URL"), file.Anthropic.BaseURL, DefaultAnthropicBaseURL)
+		
+		// Standard model name without suffix by default
+		cfg.Model = firstOf(flags.Model, os.Getenv("CLAUDE_MODEL"), file.Anthropic.Model, "claude-3-sonnet-20240229")
+	case BackendOpenAI:
+		cfg.OpenAIBaseURL = firstOf(os.Getenv("OPENAI_BASE_URL"), file.OpenAI.BaseURL, DefaultOpenAIBaseURL)
+		cfg.OpenAIAPIKey = firstOf(os.Getenv("OPENAI_API_KEY"), file.OpenAI.APIKey)
+		
+		cfg.Model = firstOf(flags.Model, os.Getenv("OPENAI_MODEL"), file.OpenAI.Model)
+		if cfg.Model == "" {
+			return Config{}, errors.New("OPENAI_MODEL environment variable not set, nor openai.model in the config file")
+		}
+	default:
+		return Config{}, fmt.Errorf("unknown LLM_BACKEND %q (expected %q or %q)", backend, BackendAnthropic, BackendOpenAI)
+	}
 	
-	return Config{
-		AnthropicAPIKey: apiKey,
-		Model:           model,
-	}, nil
+	maxTokens := DefaultMaxTokens
+	if file.MaxTokens != nil {
+		maxTokens = *file.MaxTokens
+	}
+	if value := os.Getenv("CLAUDE_MAX_TOKENS"); value != "" {
+		n, err := parseMaxTokens("CLAUDE_MAX_TOKENS", value)
+		if err != nil {
+			return Config{}, err
+		}
+		maxTokens = n
+	}
+	if flags.MaxTokens != 0 {
+		if flags.MaxTokens < 0 {
+			return Config{}, fmt.Errorf("--max-tokens must be a positive number, got %d", flags.MaxTokens)
+		}
+		maxTokens = flags.MaxTokens
+	}
+	
+	routes, err := loadRoutes(backend, file)
+	if err != nil {
+		return Config{}, err
+	}
+	
+	cfg.MaxTokens = maxTokens
+	cfg.Routes = routes
+	
+	cfg.MaxContinuations = DefaultMaxContinuations
+	if file.MaxContinuations != nil {
+		cfg.MaxContinuations = *file.MaxContinuations
+	}
+	if value := os.Getenv("CLAUDE_MAX_CONTINUATIONS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return Config{}, fmt.Errorf("CLAUDE_MAX_CONTINUATIONS must be zero or a positive number, got %q", value)
+		}
+		cfg.MaxContinuations = n
+	}
+	
+	cfg.PromptCaching = true
+	if file.PromptCaching != nil {
+		cfg.PromptCaching = *file.PromptCaching
+	}
+	switch strings.ToLower(os.Getenv("CLAUDE_PROMPT_CACHING")) {
+	case "":
+	case "0", "false", "off", "no":
+		cfg.PromptCaching = false
+	default:
+		cfg.PromptCaching = true
+	}
+	
+	if file.ThinkingBudget != nil {
+		if err := checkThinkingBudget(file, "thinking_budget", *file.ThinkingBudget); err != nil {
+			return Config{}, err
+		}
+		cfg.ThinkingBudget = *file.ThinkingBudget
+	}
+	if value := os.Getenv("CLAUDE_THINKING_BUDGET"); value != "" {
+		n, err := parseThinkingBudget("CLAUDE_THINKING_BUDGET", value)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.ThinkingBudget = n
+	}
+	
+	prompts, err := loadPrompts(file, flags.Persona)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Prompts = prompts
+	
+	cache, err := loadCache(file)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Cache = cache
+	
+	cfg.Gmail, cfg.Slack = loadProviders(file, vault, profile)
+	return cfg, noAPIKey
+}
+
+// anthropicAPIKey looks the Anthropic API key up in the vault, under the
+// profile's own name first and then the name shared by every profile
+func anthropicAPIKey(vault *secrets.Vault, profile string) (string, error) {
+	names := []string{secrets.AnthropicAPIKey}
+	if profile != "" {
+		names = []string{SecretName(profile, secrets.AnthropicAPIKey), secrets.AnthropicAPIKey}
+	}
+	for _, name := range names {
+		key, ok, err := vault.Get(name)
+		if err != nil {
+			return "", fmt.Errorf("unable to read the Anthropic API key: %v", err)
+		}
+		if ok {
+			return key, nil
+		}
+	}
+	return "", ErrNoAPIKey
+}
+
+// loadRoutes reads per-task overrides from the routes section of the config
+// file, then CLAUDE_MODEL_<TASK>, CLAUDE_MAX_TOKENS_<TASK> and
+// CLAUDE_THINKING_BUDGET_<TASK>, on top of the default of sending email triage
+// to the small Claude model
+func loadRoutes(backend string, file *configFile) (map[string]Route, error) {
+	routes := map[string]Route{}
+	if backend == BackendAnthropic {
+		routes["email"] = Route{Model: SmallModel}
+	}
+	
+	for task, override := range file.Routes {
+		route := routes[task]
+		if override.Model != "" {
+			route.Model = override.Model
+		}
+		if override.MaxTokens != nil {
+			route.MaxTokens = *override.MaxTokens
+		}
+		if override.ThinkingBudget != nil {
+			if err := checkThinkingBudget(file, "routes."+task+".thinking_budget", *override.ThinkingBudget); err != nil {
+				return nil, err
+			}
+			route.ThinkingBudget = *override.ThinkingBudget
+		}
+		routes[task] = route
+	}
+	
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if value == "" {
+			continue
+		}
+		
+		switch {
+		case strings.HasPrefix(name, "CLAUDE_MODEL_"):
+			task := strings.ToLower(strings.TrimPrefix(name, "CLAUDE_MODEL_"))
+			route := routes[task]
+			route.Model = value
+			routes[task] = route
+		case strings.HasPrefix(name, "CLAUDE_MAX_TOKENS_"):
+			n, err := parseMaxTokens(name, value)
+			if err != nil {
+				return nil, err
+			}
+			task := strings.ToLower(strings.TrimPrefix(name, "CLAUDE_MAX_TOKENS_"))
+			route := routes[task]
+			route.MaxTokens = n
+			routes[task] = route
+		case strings.HasPrefix(name, "CLAUDE_THINKING_BUDGET_"):
+			n, err := parseThinkingBudget(name, value)
+			if err != nil {
+				return nil, err
+			}
+			task := strings.ToLower(strings.TrimPrefix(name, "CLAUDE_THINKING_BUDGET_"))
+			route := routes[task]
+			route.ThinkingBudget = n
+			routes[task] = route
+		}
+	}
+	
+	return routes, nil
+}
+
+// loadProviders reads the Gmail and Slack settings from GMAIL_CREDENTIALS,
+// GMAIL_TOKEN, SLACK_TOKEN and SLACK_TOKEN_PATH, then the gmail and slack
+// sections of the config file, with files kept in the profile's directory by
+// default. Both keep their tokens in vault, under names of the profile's own.
+func loadProviders(file *configFile, vault *secrets.Vault, profile string) (Gmail, Slack) {
+	var credentials, gmailToken, slackTokenPath string
+	if dir, err := ProfileDir(profile); err == nil {
+		credentials = filepath.Join(dir, "gmail_credentials.json")
+		gmailToken = filepath.Join(dir, "gmail_token.json")
+		slackTokenPath = filepath.Join(dir, "slack_token.txt")
+	}
+	
+	gmail := Gmail{
+		Credentials: expandHome(firstOf(os.Getenv("GMAIL_CREDENTIALS"), file.Gmail.Credentials, credentials)),
+		Token:       expandHome(firstOf(os.Getenv("GMAIL_TOKEN"), file.Gmail.Token, gmailToken)),
+		Secrets:     vault,
+		TokenSecret: SecretName(profile, secrets.GmailToken),
+	}
+	slack := Slack{
+		Token:       firstOf(os.Getenv("SLACK_TOKEN"), file.Slack.Token),
+		TokenPath:   expandHome(firstOf(os.Getenv("SLACK_TOKEN_PATH"), file.Slack.TokenPath, slackTokenPath)),
+		Secrets:     vault,
+		TokenSecret: SecretName(profile, secrets.SlackToken),
+	}
+	return gmail, slack
+}
+
+// OpenSecrets returns the vault of secrets kept in Dir, which asks for its
+// passphrase when first used
+func OpenSecrets() *secrets.Vault {
+	var path string
+	if dir, err := Dir(); err == nil {
+		path = filepath.Join(dir, secrets.FileName)
+	}
+	return secrets.New(path, secrets.Prompt)
+}
+
+// firstOf returns the first value that is set, so that settings can be
+// listed in order of precedence
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseMaxTokens validates a max tokens setting
+func parseMaxTokens(name string, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number, got %q", name, value)
+	}
+	return n, nil
+}
+
+// parseThinkingBudget validates a thinking budget setting, where zero
+// disables thinking
+func parseThinkingBudget(name string, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || (n > 0 && n < MinThinkingBudget) {
+		return 0, fmt.Errorf("%s must be 0 to disable thinking or at least %d, got %q", name, MinThinkingBudget, value)
+	}
+	return n, nil
+}
+
+// checkThinkingBudget validates a thinking budget set in the config file
+func checkThinkingBudget(file *configFile, setting string, n int) error {
+	if n > 0 && n < MinThinkingBudget {
+		return file.errorAt(setting, "must be 0 to disable thinking or at least %d, got %d", MinThinkingBudget, n)
+	}
+	return nil
 }
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolate clears every environment variable the configuration is read from,
+// and points the home directory somewhere empty
+func isolate(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(name, "CLAUDE_") || strings.HasPrefix(name, "ANTHROPIC_") || strings.HasPrefix(name, "OPENAI_") ||
+			strings.HasPrefix(name, "GMAIL_") || strings.HasPrefix(name, "SLACK_") || strings.HasPrefix(name, "PRODTERM_") ||
+			name == "LLM_BACKEND" {
+			t.Setenv(name, "")
+		}
+	}
+	return home
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const file = `
+anthropic:
+  api_key: sk-ant-file
+  model: file-model
+max_tokens: 100
+`
+	const profiles = `
+profile: work
+profiles:
+  work:
+    anthropic:
+      model: profile-model
+    max_tokens: 200
+`
+	tests := []struct {
+		name          string
+		content       string
+		env           map[string]string
+		flags         Flags
+		wantModel     string
+		wantMaxTokens int
+	}{
+		{
+			name:          "defaults",
+			content:       "anthropic:\n  api_key: sk-ant-file\n",
+			wantModel:     "claude-3-sonnet-20240229",
+			wantMaxTokens: DefaultMaxTokens,
+		},
+		{
+			name:          "file over defaults",
+			content:       file,
+			wantModel:     "file-model",
+			wantMaxTokens: 100,
+		},
+		{
+			name:          "profile over file",
+			content:       file + profiles,
+			wantModel:     "profile-model",
+			wantMaxTokens: 200,
+		},
+		{
+			name:          "environment over profile",
+			content:       file + profiles,
+			env:           map[string]string{"CLAUDE_MODEL": "env-model", "CLAUDE_MAX_TOKENS": "300"},
+			wantModel:     "env-model",
+			wantMaxTokens: 300,
+		},
+		{
+			name:          "flags over environment",
+			content:       file + profiles,
+			env:           map[string]string{"CLAUDE_MODEL": "env-model", "CLAUDE_MAX_TOKENS": "300"},
+			flags:         Flags{Model: "flag-model", MaxTokens: 400},
+			wantModel:     "flag-model",
+			wantMaxTokens: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			flags := tt.flags
+			flags.ConfigPath = writeConfig(t, tt.content)
+
+			cfg, err := LoadWithSecrets(flags, nil)
+			if err != nil {
+				t.Fatalf("LoadWithSecrets: %v", err)
+			}
+			if cfg.Model != tt.wantModel || cfg.MaxTokens != tt.wantMaxTokens {
+				t.Errorf("model %q, max tokens %d; want %q, %d", cfg.Model, cfg.MaxTokens, tt.wantModel, tt.wantMaxTokens)
+			}
+		})
+	}
+}
+
+func TestLoadProfileSelection(t *testing.T) {
+	const content = `
+anthropic:
+  api_key: sk-ant-file
+  model: file-model
+profile: work
+profiles:
+  work:
+    anthropic:
+      model: work-model
+  home:
+    anthropic:
+      model: home-model
+`
+	tests := []struct {
+		name        string
+		env         string
+		flag        string
+		wantProfile string
+		wantModel   string
+	}{
+		{name: "file", wantProfile: "work", wantModel: "work-model"},
+		{name: "environment over file", env: "home", wantProfile: "home", wantModel: "home-model"},
+		{name: "flag over environment", env: "home", flag: "default", wantProfile: "", wantModel: "file-model"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			t.Setenv("PRODTERM_PROFILE", tt.env)
+
+			cfg, err := LoadWithSecrets(Flags{ConfigPath: writeConfig(t, content), Profile: tt.flag}, nil)
+			if err != nil {
+				t.Fatalf("LoadWithSecrets: %v", err)
+			}
+			if cfg.Profile != tt.wantProfile || cfg.Model != tt.wantModel {
+				t.Errorf("profile %q, model %q; want %q, %q", cfg.Profile, cfg.Model, tt.wantProfile, tt.wantModel)
+			}
+			if len(cfg.Profiles) != 2 {
+				t.Errorf("profiles = %q", cfg.Profiles)
+			}
+		})
+	}
+}
+
+func TestLoadUnknownProfile(t *testing.T) {
+	isolate(t)
+	path := writeConfig(t, "anthropic:\n  api_key: sk-ant-file\nprofiles:\n  work: {}\n")
+
+	_, err := LoadWithSecrets(Flags{ConfigPath: path, Profile: "play"}, nil)
+	if err == nil || !strings.Contains(err.Error(), `unknown profile "play"`) || !strings.Contains(err.Error(), "work") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoadProviderSections(t *testing.T) {
+	home := isolate(t)
+	path := writeConfig(t, `
+anthropic:
+  api_key: sk-ant-file
+gmail:
+  credentials: ~/google/credentials.json
+  token: /var/lib/prodterm/gmail_token.json
+slack:
+  token: xoxb-from-file
+  token_path: ~/slack.txt
+profiles:
+  work:
+    slack:
+      token: xoxb-work
+`)
+
+	cfg, err := LoadWithSecrets(Flags{ConfigPath: path}, nil)
+	if err != nil {
+		t.Fatalf("LoadWithSecrets: %v", err)
+	}
+	if want := filepath.Join(home, "google", "credentials.json"); cfg.Gmail.Credentials != want {
+		t.Errorf("gmail credentials = %q, want %q", cfg.Gmail.Credentials, want)
+	}
+	if cfg.Gmail.Token != "/var/lib/prodterm/gmail_token.json" {
+		t.Errorf("gmail token = %q", cfg.Gmail.Token)
+	}
+	if cfg.Slack.Token != "xoxb-from-file" || cfg.Slack.TokenPath != filepath.Join(home, "slack.txt") {
+		t.Errorf("slack = %+v", cfg.Slack)
+	}
+	if cfg.Slack.TokenSecret != "slack_token" || cfg.Gmail.TokenSecret != "gmail_token" {
+		t.Errorf("secret names = %q, %q", cfg.Slack.TokenSecret, cfg.Gmail.TokenSecret)
+	}
+
+	cfg, err = LoadWithSecrets(Flags{ConfigPath: path, Profile: "work"}, nil)
+	if err != nil {
+		t.Fatalf("LoadWithSecrets with a profile: %v", err)
+	}
+	if cfg.Slack.Token != "xoxb-work" || cfg.Slack.TokenSecret != "work.slack_token" {
+		t.Errorf("slack in the work profile = %+v", cfg.Slack)
+	}
+
+	// The environment still comes first
+	t.Setenv("SLACK_TOKEN", "xoxb-from-env")
+	cfg, err = LoadWithSecrets(Flags{ConfigPath: path, Profile: "work"}, nil)
+	if err != nil {
+		t.Fatalf("LoadWithSecrets with SLACK_TOKEN: %v", err)
+	}
+	if cfg.Slack.Token != "xoxb-from-env" {
+		t.Errorf("slack token = %q, want the one from SLACK_TOKEN", cfg.Slack.Token)
+	}
+}
+
+func TestLoadProviderDefaults(t *testing.T) {
+	home := isolate(t)
+	path := writeConfig(t, "anthropic:\n  api_key: sk-ant-file\nprofiles:\n  work: {}\n")
+
+	cfg, err := LoadWithSecrets(Flags{ConfigPath: path, Profile: "work"}, nil)
+	if err != nil {
+		t.Fatalf("LoadWithSecrets: %v", err)
+	}
+	dir := filepath.Join(home, ".config", "terminal-claude", "profiles", "work")
+	if cfg.Gmail.Credentials != filepath.Join(dir, "gmail_credentials.json") || cfg.Slack.TokenPath != filepath.Join(dir, "slack_token.txt") {
+		t.Errorf("gmail %+v, slack %+v; want files in %s", cfg.Gmail, cfg.Slack, dir)
+	}
+}
+
+func TestLoadMissingAPIKey(t *testing.T) {
+	isolate(t)
+	cfg, err := LoadWithSecrets(Flags{ConfigPath: writeConfig(t, "max_tokens: 10\n")}, nil)
+	if err != ErrNoAPIKey {
+		t.Fatalf("err = %v, want ErrNoAPIKey", err)
+	}
+	if cfg.MaxTokens != 10 {
+		t.Errorf("the rest of the configuration was not returned: %+v", cfg)
+	}
+}
@@ -0,0 +1,336 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the config file in Dir
+const FileName = "config.yaml"
+
+// fileConfig is the layout of the config file. Every setting is optional;
+// unset settings fall back to environment variables and then the defaults.
+// An `enum` tag lists a setting's allowed values and a `min` tag its
+// smallest allowed value.
+type fileConfig struct {
+	Backend          string               `yaml:"backend" enum:"anthropic,openai"`
+	MaxTokens        *int                 `yaml:"max_tokens" min:"1"`
+	MaxContinuations *int                 `yaml:"max_continuations" min:"0"`
+	PromptCaching    *bool                `yaml:"prompt_caching"`
+	ThinkingBudget   *int                 `yaml:"thinking_budget" min:"0"`
+	Routes           map[string]fileRoute `yaml:"routes"`
+	Prompts          filePrompts          `yaml:"prompts"`
+	Cache            fileCache            `yaml:"cache"`
+
+	Anthropic fileAnthropic `yaml:"anthropic"`
+	OpenAI    fileOpenAI    `yaml:"openai"`
+	Gmail     fileGmail     `yaml:"gmail"`
+	Slack     fileSlack     `yaml:"slack"`
+
+	// Profiles bundle settings laid over the rest of the file when selected,
+	// and Profile selects one by default
+	Profiles map[string]fileConfig `yaml:"profiles"`
+	Profile  string                `yaml:"profile"`
+}
+
+// fileRoute overrides settings for one task
+type fileRoute struct {
+	Model          string `yaml:"model"`
+	MaxTokens      *int   `yaml:"max_tokens" min:"1"`
+	ThinkingBudget *int   `yaml:"thinking_budget" min:"0"`
+}
+
+// filePrompts configures system prompts and personas
+type filePrompts struct {
+	System   string                 `yaml:"system"`
+	Tasks    map[string]string      `yaml:"tasks"`
+	Personas map[string]filePersona `yaml:"personas"`
+	Persona  string                 `yaml:"persona"`
+}
+
+// filePersona adds or replaces a persona
+type filePersona struct {
+	Description string `yaml:"description"`
+	Prompt      string `yaml:"prompt"`
+}
+
+// fileCache configures the response cache
+type fileCache struct {
+	Enabled      *bool                    `yaml:"enabled"`
+	TTL          *time.Duration           `yaml:"ttl" min:"0"`
+	MaxMB        *int                     `yaml:"max_mb" min:"1"`
+	ProviderTTL  *time.Duration           `yaml:"provider_ttl" min:"0"`
+	ProviderTTLs map[string]time.Duration `yaml:"provider_ttls" min:"0"`
+}
+
+// fileAnthropic configures the Anthropic API
+type fileAnthropic struct {
+	APIKey  string `yaml:"api_key"`
+	BaseURL string `yaml:"base_url"`
+	Model   string `yaml:"model"`
+}
+
+// fileOpenAI configures an OpenAI-compatible server
+type fileOpenAI struct {
+	APIKey  string `yaml:"api_key"`
+	BaseURL string `yaml:"base_url"`
+	Model   string `yaml:"model"`
+}
+
+// fileGmail configures the Gmail provider
+type fileGmail struct {
+	Credentials string `yaml:"credentials"`
+	Token       string `yaml:"token"`
+}
+
+// fileSlack configures the Slack provider
+type fileSlack struct {
+	Token     string `yaml:"token"`
+	TokenPath string `yaml:"token_path"`
+}
+
+// configFile is a config file that has been read and checked
+type configFile struct {
+	fileConfig
+	path string
+
+	// positions records where each setting was found, keyed by its dotted
+	// path such as "routes.chat.max_tokens", for error messages
+	positions map[string]*yaml.Node
+}
+
+// errorAt describes a problem with a setting, pointing at where it was set
+func (f *configFile) errorAt(setting string, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	if node, ok := f.positions[setting]; ok {
+		return fmt.Errorf("%s:%d:%d: %s: %s", f.path, node.Line, node.Column, setting, message)
+	}
+	return fmt.Errorf("%s: %s: %s", f.path, setting, message)
+}
+
+// source names a setting in the config file, for messages
+func (f *configFile) source(setting string) string {
+	return fmt.Sprintf("%s in %s", setting, f.path)
+}
+
+// readConfigFile reads and checks the config file at path. A missing file is
+// only an error when required is set; otherwise an empty file is returned.
+func readConfigFile(path string, required bool) (*configFile, error) {
+	file := &configFile{path: path, positions: map[string]*yaml.Node{}}
+	if path == "" {
+		return file, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %v", err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	if len(document.Content) == 0 {
+		return file, nil
+	}
+	root := document.Content[0]
+
+	// Check the whole file against the layout first, so that every mistake
+	// is reported with its line rather than only the first one decoding
+	// stumbles on
+	var problems []string
+	checkNode(root, reflect.TypeOf(fileConfig{}), "", reflect.StructTag(""), file.positions, &problems)
+	if len(problems) > 0 {
+		for i, problem := range problems {
+			problems[i] = path + ":" + problem
+		}
+		return nil, fmt.Errorf("invalid config file:\n%s", strings.Join(problems, "\n"))
+	}
+
+	if err := root.Decode(&file.fileConfig); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	if err := file.checkProfiles(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// checkNode checks that node holds a value of type t, recording the position
+// of each setting and describing each problem found
+func checkNode(node *yaml.Node, t reflect.Type, path string, tag reflect.StructTag, positions map[string]*yaml.Node, problems *[]string) {
+	if path != "" {
+		positions[path] = node
+	}
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	problem := func(format string, args ...interface{}) {
+		*problems = append(*problems, fmt.Sprintf("%d:%d: %s: %s", node.Line, node.Column, path, fmt.Sprintf(format, args...)))
+	}
+
+	// An empty value leaves a setting unset
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	switch {
+	case t == durationType:
+		if node.Kind != yaml.ScalarNode {
+			problem("expected a duration such as 90s or 10m")
+			return
+		}
+		d, err := time.ParseDuration(node.Value)
+		if err != nil {
+			problem("expected a duration such as 90s or 10m, got %q", node.Value)
+			return
+		}
+		if minimum, ok := tag.Lookup("min"); ok && minimum == "0" && d < 0 {
+			problem("must not be negative, got %s", node.Value)
+		}
+
+	case t.Kind() == reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			problem("expected a section of settings")
+			return
+		}
+		fields := map[string]reflect.StructField{}
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			fields[name] = field
+			names = append(names, name)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				message := fmt.Sprintf("%d:%d: unknown setting %q", key.Line, key.Column, joinPath(path, key.Value))
+				if suggestion := closest(key.Value, names); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				*problems = append(*problems, message)
+				continue
+			}
+			checkNode(value, field.Type, joinPath(path, key.Value), field.Tag, positions, problems)
+		}
+
+	case t.Kind() == reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			problem("expected a section of named entries")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			checkNode(value, t.Elem(), joinPath(path, key.Value), tag, positions, problems)
+		}
+
+	case t.Kind() == reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			problem("expected a single value")
+			return
+		}
+		if enum, ok := tag.Lookup("enum"); ok {
+			allowed := strings.Split(enum, ",")
+			found := false
+			for _, value := range allowed {
+				found = found || value == node.Value
+			}
+			if !found {
+				problem("must be one of %s, got %q", strings.Join(allowed, ", "), node.Value)
+			}
+		}
+
+	case t.Kind() == reflect.Int:
+		n, err := strconv.Atoi(node.Value)
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" || err != nil {
+			problem("expected a whole number, got %q", node.Value)
+			return
+		}
+		if minimum, ok := tag.Lookup("min"); ok {
+			if limit, _ := strconv.Atoi(minimum); n < limit {
+				problem("must be at least %d, got %d", limit, n)
+			}
+		}
+
+	case t.Kind() == reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			problem("expected true or false, got %q", node.Value)
+		}
+	}
+}
+
+// joinPath names a setting within a section
+func joinPath(section string, name string) string {
+	if section == "" {
+		return name
+	}
+	return section + "." + name
+}
+
+// closest returns the known setting nearest to a misspelt one, if any is
+// close enough to be a plausible typo
+func closest(name string, known []string) string {
+	sort.Strings(known)
+	best, bestDistance := "", 3
+	for _, candidate := range known {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance counts the single character edits needed to turn a into b
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// expandHome replaces a leading ~ in a path with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file into a fresh directory and returns its
+// path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfigFileReportsProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "unknown setting with suggestion",
+			content: "max_token: 10\n",
+			want:    []string{`:1:1: unknown setting "max_token" (did you mean "max_tokens"?)`},
+		},
+		{
+			name:    "unknown setting in a section",
+			content: "anthropic:\n  modle: claude-3-opus-20240229\n",
+			want:    []string{`:2:3: unknown setting "anthropic.modle" (did you mean "model"?)`},
+		},
+		{
+			name:    "unknown setting without a close match",
+			content: "colour: blue\n",
+			want:    []string{`:1:1: unknown setting "colour"`},
+		},
+		{
+			name:    "whole number expected",
+			content: "max_tokens: lots\n",
+			want:    []string{`:1:13: max_tokens: expected a whole number, got "lots"`},
+		},
+		{
+			name:    "true or false expected",
+			content: "prompt_caching: maybe\n",
+			want:    []string{`:1:17: prompt_caching: expected true or false, got "maybe"`},
+		},
+		{
+			name:    "duration expected",
+			content: "cache:\n  ttl: soon\n",
+			want:    []string{`:2:8: cache.ttl: expected a duration such as 90s or 10m, got "soon"`},
+		},
+		{
+			name:    "section expected",
+			content: "gmail: yes\n",
+			want:    []string{`:1:8: gmail: expected a section of settings`},
+		},
+		{
+			name:    "value not allowed",
+			content: "backend: gpt\n",
+			want:    []string{`:1:10: backend: must be one of anthropic, openai, got "gpt"`},
+		},
+		{
+			name:    "below the minimum",
+			content: "routes:\n  chat:\n    max_tokens: 0\n",
+			want:    []string{`:3:17: routes.chat.max_tokens: must be at least 1, got 0`},
+		},
+		{
+			name:    "every problem is reported",
+			content: "max_tokens: lots\nslack:\n  tokn: x\n",
+			want: []string{
+				`:1:13: max_tokens: expected a whole number`,
+				`:3:3: unknown setting "slack.tokn" (did you mean "token"?)`,
+			},
+		},
+		{
+			name:    "profile settings are checked too",
+			content: "profiles:\n  work:\n    max_tokens: many\n",
+			want:    []string{`:3:17: profiles.work.max_tokens: expected a whole number, got "many"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.content)
+			_, err := readConfigFile(path, true)
+			if err == nil {
+				t.Fatalf("no error for %q", tt.content)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), path+want) {
+					t.Errorf("error %q does not contain %q", err, path+want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadConfigFileAcceptsValidFile(t *testing.T) {
+	path := writeConfig(t, `
+backend: anthropic
+max_tokens: 2048
+prompt_caching: false
+routes:
+  chat:
+    model: claude-3-opus-20240229
+cache:
+  enabled: true
+  ttl: 30m
+gmail:
+  credentials: ~/gmail.json
+slack:
+  token:
+`)
+	file, err := readConfigFile(path, true)
+	if err != nil {
+		t.Fatalf("readConfigFile: %v", err)
+	}
+	if *file.MaxTokens != 2048 || *file.PromptCaching || file.Routes["chat"].Model != "claude-3-opus-20240229" {
+		t.Errorf("settings = %+v", file.fileConfig)
+	}
+	if node := file.positions["routes.chat.model"]; node == nil || node.Line != 7 {
+		t.Errorf("position of routes.chat.model = %+v", node)
+	}
+}
+
+func TestReadConfigFileMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	if _, err := readConfigFile(path, false); err != nil {
+		t.Errorf("optional file: %v", err)
+	}
+	if _, err := readConfigFile(path, true); err == nil {
+		t.Errorf("no error for a required file that is missing")
+	}
+}
+
+func TestClosest(t *testing.T) {
+	known := []string{"backend", "max_tokens", "max_continuations", "prompts"}
+	tests := map[string]string{
+		"max_token":  "max_tokens",
+		"backnd":     "backend",
+		"prompt":     "prompts",
+		"thinking":   "",
+		"max_tokens": "max_tokens",
+	}
+	for name, want := range tests {
+		if got := closest(name, known); got != want {
+			t.Errorf("closest(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
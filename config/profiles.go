@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile names the settings outside any profile
+const DefaultProfile = "default"
+
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ProfileDir returns the directory a profile keeps its local files in: Dir
+// itself for the default profile, and a directory under profiles/ for the
+// others
+func ProfileDir(profile string) (string, error) {
+	dir, err := Dir()
+	if err != nil || profile == "" {
+		return dir, err
+	}
+	return filepath.Join(dir, "profiles", profile), nil
+}
+
+// SecretName returns the name a profile keeps a secret under in the vault,
+// such as "work.slack_token", so that profiles can share one vault
+func SecretName(profile string, name string) string {
+	if profile == "" {
+		return name
+	}
+	return profile + "." + name
+}
+
+// profileNames returns the names of the profiles in the config file
+func (f *configFile) profileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkProfiles checks the names and settings of the profiles
+func (f *configFile) checkProfiles() error {
+	for _, name := range f.profileNames() {
+		profile := f.Profiles[name]
+		setting := "profiles." + name
+		switch {
+		case name == DefaultProfile:
+			return f.errorAt(setting, "%q names the settings outside any profile; choose another name", DefaultProfile)
+		case !profileNamePattern.MatchString(name):
+			return f.errorAt(setting, "invalid profile name: use lower case letters, digits, '_' and '-'")
+		case profile.Profile != "":
+			return f.errorAt(setting+".profile", "only the top level of the config file can choose a profile")
+		case len(profile.Profiles) > 0:
+			return f.errorAt(setting+".profiles", "profiles cannot contain other profiles")
+		}
+	}
+	return nil
+}
+
+// selectProfile picks the profile named by the --profile flag,
+// PRODTERM_PROFILE or the config file, and lays its settings over the rest of
+// the file. It returns the profile's name, or an empty string for the
+// default profile.
+func (f *configFile) selectProfile(flagProfile string) (string, error) {
+	name := firstOf(flagProfile, os.Getenv("PRODTERM_PROFILE"), f.Profile)
+	if name == "" || name == DefaultProfile {
+		return "", nil
+	}
+
+	profile, ok := f.Profiles[name]
+	if !ok {
+		if len(f.Profiles) == 0 {
+			return "", fmt.Errorf("unknown profile %q: no profiles are defined in %s", name, f.path)
+		}
+		return "", fmt.Errorf("unknown profile %q (profiles in %s: %s)", name, f.path, strings.Join(f.profileNames(), ", "))
+	}
+	overlay(reflect.ValueOf(&f.fileConfig).Elem(), reflect.ValueOf(profile))
+
+	// Point messages about the profile's settings at where it sets them
+	prefix := "profiles." + name + "."
+	for setting, node := range f.positions {
+		if rest, ok := strings.CutPrefix(setting, prefix); ok {
+			f.positions[rest] = node
+		}
+	}
+	return name, nil
+}
+
+// overlay copies every setting made in override over base. Sections are
+// merged setting by setting, and named entries such as routes entry by
+// entry.
+func overlay(base reflect.Value, override reflect.Value) {
+	for i := 0; i < base.NumField(); i++ {
+		field, value := base.Field(i), override.Field(i)
+		switch value.Kind() {
+		case reflect.Struct:
+			overlay(field, value)
+		case reflect.Map:
+			if value.Len() == 0 {
+				continue
+			}
+			if field.IsNil() {
+				field.Set(reflect.MakeMap(field.Type()))
+			}
+			entries := value.MapRange()
+			for entries.Next() {
+				entry := entries.Value()
+				if existing := field.MapIndex(entries.Key()); existing.IsValid() && existing.Kind() == reflect.Struct {
+					merged := reflect.New(existing.Type()).Elem()
+					merged.Set(existing)
+					overlay(merged, entry)
+					entry = merged
+				}
+				field.SetMapIndex(entries.Key(), entry)
+			}
+		default:
+			if !value.IsZero() {
+				field.Set(value)
+			}
+		}
+	}
+}
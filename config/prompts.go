@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultSystemPrompt is the system prompt used when none is configured
+const DefaultSystemPrompt = "You are Claude, an AI assistant by Anthropic. You're helpful, harmless, and honest."
+
+// Prompts configures the system prompt sent with each request
+type Prompts struct {
+	// System is the base system prompt, e.g. a description of the team and
+	// how it likes its summaries; empty means DefaultSystemPrompt
+	System string
+
+	// Tasks replace System for particular tasks, keyed by task name
+	// (e.g. "email", "slack", "webpage")
+	Tasks map[string]string
+
+	// Personas are named styles that can be added to the system prompt
+	Personas map[string]Persona
+
+	// Persona is the name of the persona to start with; empty means none
+	Persona string
+}
+
+// Persona is a named style of answering, added to the end of the system prompt
+type Persona struct {
+	Description string
+	Prompt      string
+}
+
+// defaultPersonas are available without any configuration
+var defaultPersonas = map[string]Persona{
+	"terse-sre": {
+		Description: "short, technical answers for on-call engineers",
+		Prompt: "Answer as an experienced site reliability engineer talking to colleagues. " +
+			"Be terse and technical: lead with impact and the next action, prefer bullet points to prose, " +
+			"call out anything that looks like an incident, and skip pleasantries.",
+	},
+	"exec-brief": {
+		Description: "a bottom line and a few bullets for busy readers",
+		Prompt: "Write for a busy executive. Start with a one-line bottom line, then at most five bullets " +
+			"covering decisions needed, risks and asks. Avoid jargon and implementation detail.",
+	},
+}
+
+// SystemPrompt returns the system prompt for a task, with the named persona
+// added when it is not empty
+func (p Prompts) SystemPrompt(task string, persona string) string {
+	prompt := p.System
+	if override, ok := p.Tasks[task]; ok {
+		prompt = override
+	}
+	if prompt == "" {
+		prompt = DefaultSystemPrompt
+	}
+
+	if persona, ok := p.Personas[persona]; ok {
+		prompt += "\n\n" + persona.Prompt
+	}
+	return prompt
+}
+
+// PersonaNames returns the names of the configured personas in order
+func (p Prompts) PersonaNames() []string {
+	names := make([]string, 0, len(p.Personas))
+	for name := range p.Personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultPrompts returns the prompts used without any configuration: the
+// default system prompt and the built-in personas
+func DefaultPrompts() Prompts {
+	personas := make(map[string]Persona, len(defaultPersonas))
+	for name, persona := range defaultPersonas {
+		personas[name] = persona
+	}
+	return Prompts{Personas: personas}
+}
+
+// loadPrompts reads the base system prompt from CLAUDE_SYSTEM_PROMPT, the
+// config file or system_prompt.md, per-task prompts from the config file and
+// CLAUDE_SYSTEM_PROMPT_<TASK>, extra personas from personas/<name>.md and the
+// config file, and the starting persona from the --persona flag,
+// CLAUDE_PERSONA or the config file
+func loadPrompts(file *configFile, flagPersona string) (Prompts, error) {
+	prompts := DefaultPrompts()
+	prompts.Tasks = map[string]string{}
+
+	dir, dirErr := Dir()
+
+	prompts.System = firstOf(os.Getenv("CLAUDE_SYSTEM_PROMPT"), file.Prompts.System)
+	if prompts.System == "" && dirErr == nil {
+		data, err := os.ReadFile(filepath.Join(dir, "system_prompt.md"))
+		if err != nil && !os.IsNotExist(err) {
+			return Prompts{}, fmt.Errorf("unable to read system prompt: %v", err)
+		}
+		prompts.System = strings.TrimSpace(string(data))
+	}
+
+	for task, prompt := range file.Prompts.Tasks {
+		prompts.Tasks[task] = prompt
+	}
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if value == "" || !strings.HasPrefix(name, "CLAUDE_SYSTEM_PROMPT_") {
+			continue
+		}
+		task := strings.ToLower(strings.TrimPrefix(name, "CLAUDE_SYSTEM_PROMPT_"))
+		prompts.Tasks[task] = value
+	}
+
+	// A persona file's first line, if it starts with "#", describes it
+	if dirErr == nil {
+		files, _ := filepath.Glob(filepath.Join(dir, "personas", "*.md"))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return Prompts{}, fmt.Errorf("unable to read persona: %v", err)
+			}
+
+			var persona Persona
+			text := strings.TrimSpace(string(data))
+			if first, rest, _ := strings.Cut(text, "\n"); strings.HasPrefix(first, "#") {
+				persona.Description = strings.TrimSpace(strings.TrimLeft(first, "#"))
+				text = strings.TrimSpace(rest)
+			}
+			persona.Prompt = text
+			if persona.Prompt == "" {
+				return Prompts{}, fmt.Errorf("persona file %s is empty", file)
+			}
+
+			prompts.Personas[strings.TrimSuffix(filepath.Base(file), ".md")] = persona
+		}
+	}
+
+	for name, persona := range file.Prompts.Personas {
+		if strings.TrimSpace(persona.Prompt) == "" {
+			return Prompts{}, file.errorAt("prompts.personas."+name, "a persona needs a prompt")
+		}
+		prompts.Personas[name] = Persona{Description: persona.Description, Prompt: strings.TrimSpace(persona.Prompt)}
+	}
+
+	// The starting persona must be one of those just loaded
+	unknown := func(persona string) string {
+		return fmt.Sprintf("unknown persona %q (available: %s)", persona, strings.Join(prompts.PersonaNames(), ", "))
+	}
+	switch {
+	case flagPersona != "":
+		prompts.Persona = flagPersona
+		if _, ok := prompts.Personas[prompts.Persona]; !ok {
+			return Prompts{}, fmt.Errorf("--persona names %s", unknown(prompts.Persona))
+		}
+	case os.Getenv("CLAUDE_PERSONA") != "":
+		prompts.Persona = os.Getenv("CLAUDE_PERSONA")
+		if _, ok := prompts.Personas[prompts.Persona]; !ok {
+			return Prompts{}, fmt.Errorf("CLAUDE_PERSONA names %s", unknown(prompts.Persona))
+		}
+	case file.Prompts.Persona != "":
+		prompts.Persona = file.Prompts.Persona
+		if _, ok := prompts.Personas[prompts.Persona]; !ok {
+			return Prompts{}, file.errorAt("prompts.persona", "%s", unknown(prompts.Persona))
+		}
+	}
+
+	return prompts, nil
+}
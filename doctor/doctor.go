@@ -0,0 +1,129 @@
+// Package doctor collects the outcomes of checks on prodterm's setup into a
+// report, with a fix for every problem found
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Status is the outcome of a check
+type Status string
+
+// Outcomes of a check
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+	Skip Status = "skip"
+)
+
+// Check is the outcome of checking one part of the setup
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// Fix says what to do about a failure or warning
+	Fix string `json:"fix,omitempty"`
+}
+
+// Passed records a check that passed
+func Passed(name string, detail string) Check {
+	return Check{Name: name, Status: Pass, Detail: detail}
+}
+
+// Warning records a check that found something worth fixing that does not
+// stop prodterm from working
+func Warning(name string, detail string, fix string) Check {
+	return Check{Name: name, Status: Warn, Detail: detail, Fix: fix}
+}
+
+// Failed records a check that found something that stops prodterm from
+// working
+func Failed(name string, detail string, fix string) Check {
+	return Check{Name: name, Status: Fail, Detail: detail, Fix: fix}
+}
+
+// Skipped records a check that could not be made, usually because an
+// earlier one failed
+func Skipped(name string, reason string) Check {
+	return Check{Name: name, Status: Skip, Detail: reason}
+}
+
+// Permissions checks that a file or directory grants no more than mode, as
+// files holding secrets should only be readable by their owner. A missing
+// file is skipped.
+func Permissions(name string, path string, mode os.FileMode) Check {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return Skipped(name, path+" does not exist")
+	}
+	if err != nil {
+		return Failed(name, err.Error(), "Check that you own "+path)
+	}
+	if extra := info.Mode().Perm() &^ mode; extra != 0 {
+		return Failed(name, fmt.Sprintf("%s has mode %o, which lets other users read or change it", path, info.Mode().Perm()),
+			fmt.Sprintf("chmod %o %s", mode, path))
+	}
+	return Passed(name, fmt.Sprintf("%s has mode %o", path, info.Mode().Perm()))
+}
+
+// Report is the outcome of every check made
+type Report struct {
+	Checks []Check
+}
+
+// Add appends the outcomes of checks to the report
+func (r *Report) Add(checks ...Check) {
+	r.Checks = append(r.Checks, checks...)
+}
+
+// OK reports whether no check failed
+func (r *Report) OK() bool {
+	return r.count(Fail) == 0
+}
+
+// count returns how many checks had an outcome
+func (r *Report) count(status Status) int {
+	n := 0
+	for _, check := range r.Checks {
+		if check.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText writes the report as a table, with the fix for each problem
+// under it and a tally at the end
+func (r *Report) WriteText(w io.Writer) {
+	width := 0
+	for _, check := range r.Checks {
+		width = max(width, len(check.Name))
+	}
+	// Lines after the first of a detail, such as those of a config file
+	// error, are indented to stay in their column
+	indent := "\n" + strings.Repeat(" ", 4+2+width+2)
+	for _, check := range r.Checks {
+		detail := strings.ReplaceAll(check.Detail, "\n", indent)
+		fmt.Fprintf(w, "%-4s  %-*s  %s\n", strings.ToUpper(string(check.Status)), width, check.Name, detail)
+		if check.Fix != "" {
+			fmt.Fprintf(w, "%-4s  %-*s  fix: %s\n", "", width, "", check.Fix)
+		}
+	}
+	fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed, %d skipped\n", r.count(Pass), r.count(Warn), r.count(Fail), r.count(Skip))
+}
+
+// WriteJSON writes the report as a JSON object
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		OK     bool    `json:"ok"`
+		Checks []Check `json:"checks"`
+	}{r.OK(), r.Checks})
+}
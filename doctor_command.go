@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"terminal-claude/api"
+	"terminal-claude/config"
+	"terminal-claude/doctor"
+	"terminal-claude/providers/gmail"
+	"terminal-claude/providers/slack"
+	"terminal-claude/secrets"
+)
+
+const doctorUsage = `Usage: prodterm doctor [--json] [--profile <name>] [--config <file>]
+
+Checks the config file, the Anthropic API key and models, Gmail, Slack and
+the permissions of files holding secrets, suggesting a fix for every
+problem found. Exits with status 1 if any check fails.`
+
+// doctorTimeout bounds the checks that call Anthropic, Google and Slack
+const doctorTimeout = time.Minute
+
+// runDoctor runs the doctor command and returns the exit code
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	var flags config.Flags
+	flags.Register(fs)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, doctorUsage)
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	report := diagnose(ctx, flags)
+	if *asJSON {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	} else {
+		report.WriteText(os.Stdout)
+	}
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// diagnose checks every part of the setup
+func diagnose(ctx context.Context, flags config.Flags) *doctor.Report {
+	report := &doctor.Report{}
+
+	cfg, err := config.LoadWithFlags(flags)
+	if err != nil && !errors.Is(err, config.ErrNoAPIKey) {
+		path, _ := config.FilePath(flags)
+		report.Add(
+			doctor.Failed("config", err.Error(), fmt.Sprintf("Correct the setting named above, in %s or the environment", path)),
+			doctor.Skipped("anthropic", "the configuration could not be loaded"),
+			doctor.Skipped("gmail", "the configuration could not be loaded"),
+			doctor.Skipped("slack", "the configuration could not be loaded"),
+		)
+		return report
+	}
+	report.Add(checkConfig(cfg))
+	report.Add(checkAnthropic(ctx, cfg, err)...)
+	report.Add(gmail.Diagnose(ctx, cfg.Gmail)...)
+	report.Add(slack.Diagnose(ctx, cfg.Slack)...)
+	report.Add(checkPermissions(cfg)...)
+	return report
+}
+
+// checkConfig describes the configuration that was loaded
+func checkConfig(cfg config.Config) doctor.Check {
+	detail := cfg.Path
+	if _, err := os.Stat(cfg.Path); err != nil {
+		detail = "no config file at " + cfg.Path + "; using the environment and defaults"
+	}
+	detail += ", backend " + cfg.Backend
+	if cfg.Profile != "" {
+		detail += ", profile " + cfg.Profile
+	}
+	return doctor.Passed("config", detail)
+}
+
+// modelCheck is a model to look up and the setting that chose it
+type modelCheck struct {
+	name    string
+	model   string
+	setting string
+}
+
+// checkAnthropic checks that the API accepts the key and knows every model
+// configured. noAPIKey is the error loading the configuration gave, if it
+// found no key.
+func checkAnthropic(ctx context.Context, cfg config.Config, noAPIKey error) []doctor.Check {
+	const keyCheck = "anthropic key"
+	keyFix := "Create a key at https://console.anthropic.com/settings/keys and run prodterm secrets set " + secrets.AnthropicAPIKey
+	if cfg.Backend == config.BackendOpenAI {
+		return []doctor.Check{doctor.Skipped(keyCheck, "the openai backend is in use, at "+cfg.OpenAIBaseURL)}
+	}
+	if noAPIKey != nil {
+		return []doctor.Check{
+			doctor.Failed(keyCheck, "no API key is configured", keyFix),
+			doctor.Skipped("anthropic model", "no API key"),
+		}
+	}
+
+	wanted := []modelCheck{{"anthropic model", cfg.Model, "anthropic.model (or CLAUDE_MODEL)"}}
+	tasks := make([]string, 0, len(cfg.Routes))
+	for task := range cfg.Routes {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+	for _, task := range tasks {
+		if model := cfg.Routes[task].Model; model != "" && model != cfg.Model {
+			wanted = append(wanted, modelCheck{"anthropic model for " + task, model,
+				fmt.Sprintf("routes.%s.model (or CLAUDE_MODEL_%s)", task, strings.ToUpper(task))})
+		}
+	}
+
+	client := api.NewClient(cfg)
+	var checks []doctor.Check
+	accepted := false
+	for _, check := range wanted {
+		info, err := client.GetModel(ctx, check.model)
+		var apiErr *api.APIError
+		switch {
+		case err == nil:
+			accepted = true
+			checks = append(checks, doctor.Passed(check.name, fmt.Sprintf("%s (%s)", check.model, info.DisplayName)))
+		case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden):
+			return []doctor.Check{
+				doctor.Failed(keyCheck, apiErr.Description(), keyFix),
+				doctor.Skipped("anthropic model", "the API key was rejected"),
+			}
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+			accepted = true
+			checks = append(checks, doctor.Failed(check.name, check.model+" is not a model the API knows",
+				fmt.Sprintf("Set %s to a model listed at https://docs.anthropic.com/en/docs/about-claude/models", check.setting)))
+		default:
+			checks = append(checks, doctor.Failed(check.name, err.Error(),
+				"Check your network connection, and ANTHROPIC_BASE_URL if it is set (now "+cfg.AnthropicBaseURL+")"))
+		}
+	}
+
+	key := doctor.Skipped(keyCheck, "the API could not be reached")
+	if accepted {
+		key = doctor.Passed(keyCheck, "accepted by the API ("+maskSecret(cfg.AnthropicAPIKey)+")")
+	}
+	return append([]doctor.Check{key}, checks...)
+}
+
+// checkPermissions checks that only their owner can read the files holding
+// secrets. Loose permissions on the config file and directory are only
+// warned about, as they need not hold any.
+func checkPermissions(cfg config.Config) []doctor.Check {
+	var checks []doctor.Check
+	if dir, err := config.Dir(); err == nil {
+		checks = append(checks, asWarning(doctor.Permissions("config directory permissions", dir, 0700)))
+	}
+	if cfg.Path != "" {
+		checks = append(checks, asWarning(doctor.Permissions("config file permissions", cfg.Path, 0600)))
+	}
+	if cfg.Secrets != nil {
+		checks = append(checks, doctor.Permissions("secret store permissions", cfg.Secrets.Path(), 0600))
+	}
+	for _, path := range []string{cfg.Gmail.Token, cfg.Slack.TokenPath} {
+		if _, err := os.Stat(path); err == nil {
+			checks = append(checks, doctor.Permissions(filepath.Base(path)+" permissions", path, 0600))
+		}
+	}
+	return checks
+}
+
+// asWarning turns a failed check into a warning
+func asWarning(check doctor.Check) doctor.Check {
+	if check.Status == doctor.Fail {
+		check.Status = doctor.Warn
+	}
+	return check
+}
+
+// maskSecret shows just enough of a secret to tell which one it is
+func maskSecret(secret string) string {
+	if len(secret) <= 12 {
+		return "…"
+	}
+	return secret[:7] + "…" + secret[len(secret)-4:]
+}
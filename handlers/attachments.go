@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"terminal-claude/api"
+	"terminal-claude/models"
+)
+
+// attachment is a file queued to go out with the next prompt
+type attachment struct {
+	name  string
+	block models.MessageContent
+}
+
+// attachmentQueue holds the files queued with /attach. It is shared between
+// the UI, which shows what is queued, and requests running in the background.
+type attachmentQueue struct {
+	mu    sync.Mutex
+	files []attachment
+}
+
+// add loads a file and queues it
+func (q *attachmentQueue) add(path string) (string, error) {
+	path = expandHome(path)
+	block, err := api.LoadAttachment(path)
+	if err != nil {
+		return "", err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.files = append(q.files, attachment{name: filepath.Base(path), block: block})
+	return filepath.Base(path), nil
+}
+
+// addText queues text to go with the next prompt, marked with where it came
+// from
+func (q *attachmentQueue) addText(name string, text string) {
+	block := models.MessageContent{
+		Type: "text",
+		Text: fmt.Sprintf("<%s>\n%s\n</%s>\n\n", name, strings.TrimRight(text, "\n"), name),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.files = append(q.files, attachment{name: name, block: block})
+}
+
+// names returns the names of the queued files
+func (q *attachmentQueue) names() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	names := make([]string, len(q.files))
+	for i, file := range q.files {
+		names[i] = file.name
+	}
+	return names
+}
+
+// blocks returns the content blocks of the queued files
+func (q *attachmentQueue) blocks() []models.MessageContent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.files) == 0 {
+		return nil
+	}
+	blocks := make([]models.MessageContent, len(q.files))
+	for i, file := range q.files {
+		blocks[i] = file.block
+	}
+	return blocks
+}
+
+// remove drops the first n queued files, once they have been sent
+func (q *attachmentQueue) remove(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > len(q.files) {
+		n = len(q.files)
+	}
+	q.files = q.files[n:]
+}
+
+// clear drops every queued file
+func (q *attachmentQueue) clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.files = nil
+}
+
+// handleAttach handles the /attach command: "/attach <path>" queues a file,
+// "/attach clear" empties the queue and a bare "/attach" lists it
+func (h *Handler) handleAttach(args string) *Result {
+	switch args {
+	case "":
+		names := h.attachments.names()
+		if len(names) == 0 {
+			return textResult("Nothing is attached. Use /attach <path> to attach an image or PDF to your next prompt.")
+		}
+		return textResult("Attached to your next prompt: " + strings.Join(names, ", "))
+	case "clear":
+		h.attachments.clear()
+		return textResult("Removed all attachments.")
+	}
+
+	name, err := h.attachments.add(args)
+	if err != nil {
+		return textResult(fmt.Sprintf("Could not attach %s: %v", args, err))
+	}
+	return textResult(fmt.Sprintf("Attached %s to your next prompt.", name))
+}
+
+// PendingAttachments returns the names of the files queued for the next prompt
+func (h *Handler) PendingAttachments() []string {
+	return h.attachments.names()
+}
+
+// AttachText queues text, such as input piped to prodterm ask, to go out
+// with the next prompt as context. Unlike the prompt, it plays no part in
+// deciding how the command is handled.
+func (h *Handler) AttachText(name string, text string) {
+	h.attachments.addText(name, text)
+}
+
+// ClearAttachments drops everything queued for the next prompt, such as
+// input left behind by a command that failed or did not send a prompt
+func (h *Handler) ClearAttachments() {
+	h.attachments.clear()
+}
+
+// expandHome expands a leading ~ to the user's home directory, as the shell
+// would have done for a path typed on the command line
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
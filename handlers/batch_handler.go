@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"terminal-claude/api"
+	"terminal-claude/batch"
+	"terminal-claude/mcp"
+)
+
+// Limits on how much is gathered for a batch
+const (
+	defaultBatchEmails = 50
+	maxBatchEmails     = 500
+	batchEmailLength   = 8000
+	batchSlackMessages = 50
+)
+
+// handleBatch handles the /batch command:
+//
+//	/batch                    list jobs
+//	/batch emails [count]     summarise each unread email
+//	/batch slack [#channel…]  summarise each channel, or every channel
+//	/batch results <job>      show a finished job's results
+//	/batch cancel <job>       stop a job
+//	/batch forget <job>       remove a job from the list
+//
+// Jobs are referred to by id or by their number in the list.
+func (h *Handler) handleBatch(ctx context.Context, args string) (*Result, error) {
+	if h.batchErr != nil {
+		return textResult(fmt.Sprintf("Batches are unavailable, as the saved jobs could not be loaded: %v. "+
+			"Fix or remove the file and restart prodterm.", h.batchErr)), nil
+	}
+	if h.batches == nil {
+		return textResult("Batches are only available with the Anthropic backend."), nil
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return textResult(h.listBatches()), nil
+	}
+
+	switch fields[0] {
+	case "emails":
+		count := defaultBatchEmails
+		if len(fields) > 1 {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n <= 0 || n > maxBatchEmails {
+				return textResult(fmt.Sprintf("Usage: /batch emails [count], with a count from 1 to %d", maxBatchEmails)), nil
+			}
+			count = n
+		}
+		return h.submitEmailBatch(ctx, count)
+	case "slack":
+		return h.submitSlackBatch(ctx, fields[1:])
+	case "results", "cancel", "forget":
+		if len(fields) != 2 {
+			return textResult(fmt.Sprintf("Usage: /batch %s <job number or id>", fields[0])), nil
+		}
+		job, ok := h.batches.Find(fields[1])
+		if !ok {
+			return textResult(fmt.Sprintf("No batch %s. Type /batch to list them.", fields[1])), nil
+		}
+		switch fields[0] {
+		case "results":
+			return textResult(formatBatchResults(job)), nil
+		case "cancel":
+			if job.Done {
+				return textResult(fmt.Sprintf("%s has already finished.", job.Name)), nil
+			}
+			if err := h.batches.Cancel(ctx, job.ID); err != nil {
+				return nil, fmt.Errorf("failed to cancel batch: %v", err)
+			}
+			return textResult(fmt.Sprintf("Cancelling %s. Results already produced will still be shown.", job.Name)), nil
+		default:
+			if err := h.batches.Forget(job.ID); err != nil {
+				return nil, fmt.Errorf("failed to forget batch: %v", err)
+			}
+			return textResult(fmt.Sprintf("Removed %s from the list.", job.Name)), nil
+		}
+	}
+
+	return textResult("Usage: /batch [emails [count] | slack [#channel ...] | results <job> | cancel <job> | forget <job>]"), nil
+}
+
+// PendingBatches returns how many batch jobs are still waiting for results
+func (h *Handler) PendingBatches() int {
+	if h.batches == nil {
+		return 0
+	}
+	return h.batches.Pending()
+}
+
+// PollBatches checks on unfinished batch jobs and returns those that have
+// finished since the last check
+func (h *Handler) PollBatches(ctx context.Context) ([]batch.Job, error) {
+	if h.batches == nil {
+		return nil, nil
+	}
+	return h.batches.Poll(ctx)
+}
+
+// listBatches describes every known batch job
+func (h *Handler) listBatches() string {
+	jobs := h.batches.Jobs()
+	if len(jobs) == 0 {
+		return "No batches yet. Use /batch emails or /batch slack to summarise a backlog in bulk."
+	}
+
+	var b strings.Builder
+	b.WriteString("Batches:\n")
+	for i, job := range jobs {
+		fmt.Fprintf(&b, "%d. %s - %s (submitted %s, %s)\n",
+			i+1, job.Name, job.Progress(), job.CreatedAt.Local().Format("Jan 2 15:04"), job.ID)
+	}
+	b.WriteString("\nUse /batch results <number> to read a finished batch.")
+	return b.String()
+}
+
+// submitEmailBatch queues a summary of each unread email
+func (h *Handler) submitEmailBatch(ctx context.Context, count int) (*Result, error) {
+	result, err := mcp.ExecuteCommand(ctx, "Gmail", "summarize_unread", map[string]interface{}{
+		"count": float64(count),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unread emails: %w", err)
+	}
+
+	summary, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type")
+	}
+	emails, _ := summary["emails"].([]map[string]interface{})
+	if len(emails) == 0 {
+		return textResult("You have no unread emails."), nil
+	}
+
+	var items []batch.Item
+	for _, email := range emails {
+		id, _ := email["id"].(string)
+		from, _ := email["from"].(string)
+		subject, _ := email["subject"].(string)
+		date, _ := email["date"].(string)
+
+		// Summarise from the full text where it can be fetched
+		body, _ := email["snippet"].(string)
+		if full, err := mcp.ExecuteCommand(ctx, "Gmail", "get_email", map[string]interface{}{"id": id}); err == nil {
+			if details, ok := full.(map[string]interface{}); ok {
+				if text, ok := details["body"].(string); ok && text != "" {
+					body = text
+				}
+			}
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if len(body) > batchEmailLength {
+			body = body[:batchEmailLength] + "... (email truncated)"
+		}
+
+		items = append(items, batch.Item{
+			ID:    "email-" + id,
+			Label: fmt.Sprintf("%s (from %s)", subject, from),
+			Prompt: fmt.Sprintf("Summarise this email in two or three sentences, including anything I need to do and by when:\n\n"+
+				"From: %s\nSubject: %s\nDate: %s\n\n%s", from, subject, date, body),
+		})
+	}
+
+	return h.submitBatch(ctx, fmt.Sprintf("%d unread emails", len(items)), api.TaskEmail, items)
+}
+
+// submitSlackBatch queues a summary of each named channel, or of every
+// channel when none are named
+func (h *Handler) submitSlackBatch(ctx context.Context, channels []string) (*Result, error) {
+	var params []map[string]interface{}
+	if len(channels) == 0 {
+		result, err := mcp.ExecuteCommand(ctx, "Slack", "list_channels", map[string]interface{}{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Slack channels: %w", err)
+		}
+		channelList, ok := result.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected result type")
+		}
+		listed, _ := channelList["channels"].([]map[string]interface{})
+		for _, channel := range listed {
+			params = append(params, map[string]interface{}{"channel_id": channel["id"]})
+		}
+	} else {
+		for _, channel := range channels {
+			params = append(params, map[string]interface{}{"channel": strings.TrimPrefix(channel, "#")})
+		}
+	}
+
+	var items []batch.Item
+	var skipped []string
+	for _, p := range params {
+		p["count"] = float64(batchSlackMessages)
+		result, err := mcp.ExecuteCommand(ctx, "Slack", "summarize_channel", p)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			skipped = append(skipped, fmt.Sprintf("%v (%v)", channelParam(p), err))
+			continue
+		}
+
+		summary, ok := result.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected result type")
+		}
+		channelName, channelData, ok := formatChannelMessages(summary)
+		if !ok {
+			continue
+		}
+		channelID, _ := summary["channel_id"].(string)
+
+		items = append(items, batch.Item{
+			ID:     "slack-" + channelID,
+			Label:  "#" + channelName,
+			Prompt: slackSummaryPrompt(channelData),
+		})
+	}
+
+	if len(items) == 0 {
+		message := "No recent Slack messages to summarise."
+		if len(skipped) > 0 {
+			message += " Skipped: " + strings.Join(skipped, ", ")
+		}
+		return textResult(message), nil
+	}
+
+	response, err := h.submitBatch(ctx, fmt.Sprintf("%d Slack channels", len(items)), api.TaskSlack, items)
+	if err == nil && len(skipped) > 0 {
+		response.Warnings = append(response.Warnings, "Skipped "+strings.Join(skipped, ", "))
+	}
+	return response, err
+}
+
+// channelParam names the channel a summarize_channel call was for
+func channelParam(params map[string]interface{}) interface{} {
+	if name, ok := params["channel"]; ok {
+		return "#" + fmt.Sprint(name)
+	}
+	return params["channel_id"]
+}
+
+// submitBatch submits items as a batch job for a task
+func (h *Handler) submitBatch(ctx context.Context, name string, task string, items []batch.Item) (*Result, error) {
+	job, err := h.batches.Submit(ctx, name, task, h.systemPrompt(task), items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit batch: %v", err)
+	}
+	return textResult(fmt.Sprintf("Submitted a batch summarising %s (%s). "+
+		"Batches usually finish within an hour and cost half as much; you'll be told when it's ready.", name, job.ID)), nil
+}
+
+// formatBatchResults renders the results of a job
+func formatBatchResults(job batch.Job) string {
+	if !job.Done {
+		return fmt.Sprintf("%s is %s. You'll be told when it's ready.", job.Name, job.Progress())
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Results of %s:\n", job.Name)
+	for _, result := range job.Results {
+		b.WriteString("\n## " + result.Label + "\n")
+		if result.Error != "" {
+			b.WriteString("(failed: " + result.Error + ")\n")
+		} else {
+			b.WriteString(result.Text + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"fmt"
+	"terminal-claude/api"
+	"terminal-claude/mcp"
+)
+
+// handleCache handles the /cache command:
+//
+//	/cache        describe the response cache
+//	/cache clear  forget every cached answer and provider result
+func (h *Handler) handleCache(args string) *Result {
+	switch args {
+	case "":
+		if h.cache == nil {
+			return textResult("The response cache is off. Set CLAUDE_RESPONSE_CACHE=on to reuse recent answers.")
+		}
+		stats, err := h.cache.Stats()
+		if err != nil {
+			return textResult(fmt.Sprintf("Unable to read the response cache: %v", err))
+		}
+		return textResult(fmt.Sprintf("The response cache holds %d answers (%s), each kept for %s. Type /cache clear to empty it.",
+			stats.Entries, api.FormatSize(stats.Bytes), h.cache.TTL()))
+	case "clear":
+		results := mcp.ClearCache()
+		if h.cache == nil {
+			return textResult(fmt.Sprintf("Cleared %d cached provider results.", results))
+		}
+		answers, err := h.cache.Clear()
+		if err != nil {
+			return textResult(fmt.Sprintf("Unable to clear the response cache: %v", err))
+		}
+		return textResult(fmt.Sprintf("Cleared %d cached answers and %d cached provider results.", answers, results))
+	}
+	return textResult("Usage: /cache [clear]")
+}
@@ -1,33 +1,35 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"terminal-claude/api"
 	"terminal-claude/mcp"
 	"time"
 )
 
 // HandleEmailSummary creates a summary of unread emails
-func (h *Handler) HandleEmailSummary() (string, error) {
+func (h *Handler) HandleEmailSummary(ctx context.Context, onDelta api.StreamFunc) (*Result, error) {
 	// Get the Gmail provider
-	result, err := mcp.ExecuteCommand("Gmail", "summarize_unread", map[string]interface{}{
+	result, err := mcp.ExecuteCommand(ctx, "Gmail", "summarize_unread", map[string]interface{}{
 		"count": 10,
 	})
 	
 	if err != nil {
-		return "", fmt.Errorf("failed to get unread emails: %v", err)
+		return nil, fmt.Errorf("failed to get unread emails: %w", err)
 	}
 	
 	// Convert result to a format we can use
 	summary, ok := result.(map[string]interface{})
 	if !ok {
-		return "", fmt.Errorf("unexpected result type")
+		return nil, fmt.Errorf("unexpected result type")
 	}
 	
 	count, _ := summary["count"].(int)
 	emails, _ := summary["emails"].([]map[string]interface{})
 	
 	if count == 0 {
-		return "You have no unread emails.", nil
+		return textResult("You have no unread emails."), nil
 	}
 	
 	// Format the email data for Claude
@@ -57,7 +59,12 @@ func (h *Handler) HandleEmailSummary() (string, error) {
 	
 	prompt := "Here are my unread emails. Please provide a brief summary of each, including who they're from and what they appear to be about:\n\n" + emailData
 	
-	return h.claudeClient.Ask(prompt)
+	response, err := h.chat(ctx, api.TaskEmail, prompt, onDelta)
+	if err != nil {
+		return nil, err
+	}
+	
+	return h.withTriage(ctx, api.TaskEmail, emailData, response)
 }
 
 // parseEmailDate parses an email date string
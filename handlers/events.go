@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"terminal-claude/mcp"
+)
+
+// Types of Event
+const (
+	EventSource = "source"
+	EventDelta  = "delta"
+	EventResult = "result"
+	EventError  = "error"
+)
+
+// Event is a step in the progress of a command, as written one per line by
+// prodterm ask --output jsonl
+type Event struct {
+	Type string `json:"type"`
+
+	// Delta is the next piece of Claude's answer, for EventDelta
+	Delta string `json:"delta,omitempty"`
+
+	// Source is a provider result as soon as it is returned, for EventSource
+	Source *mcp.Call `json:"source,omitempty"`
+
+	// Result is the outcome of the command, including every source again,
+	// for EventResult
+	Result *Result `json:"result,omitempty"`
+
+	// Error says why the command failed, for EventError
+	Error string `json:"error,omitempty"`
+}
+
+// ProcessCommandEvents handles a command like ProcessCommandStream, passing
+// each provider result and piece of Claude's answer to emit as they arrive,
+// followed by the result or the error. Provider commands may run in
+// parallel, so emit must be safe to call from more than one goroutine.
+func (h *Handler) ProcessCommandEvents(ctx context.Context, command string, emit func(Event)) (*Result, error) {
+	ctx = mcp.WithTrace(ctx, func(call mcp.Call) {
+		emit(Event{Type: EventSource, Source: &call})
+	})
+	result, err := h.ProcessCommandStream(ctx, command, func(delta string) {
+		emit(Event{Type: EventDelta, Delta: delta})
+	})
+	if err != nil {
+		emit(Event{Type: EventError, Error: err.Error()})
+		return nil, err
+	}
+	emit(Event{Type: EventResult, Result: result})
+	return result, nil
+}
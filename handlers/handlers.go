@@ -1,37 +1,231 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"path/filepath"
 	"strings"
+	"sync"
 	"terminal-claude/api"
+	"terminal-claude/batch"
+	"terminal-claude/cache"
 	"terminal-claude/config"
+	"terminal-claude/mcp"
+	"terminal-claude/usage"
+	"time"
 )
 
+// webpageTimeout bounds how long fetching a webpage may take
+const webpageTimeout = 20 * time.Second
+
 // Handler processes user commands
 type Handler struct {
-	claudeClient *api.Client
+	llm          api.LLM
+	conversation *api.Conversation
+	usage        *usage.Tracker
+	attachments  *attachmentQueue
+	prompts      config.Prompts
+	
+	// batches runs bulk summaries; nil when the LLM cannot run batches, or
+	// when the saved jobs could not be loaded, which batchErr says why
+	batches  *batch.Manager
+	batchErr error
+	
+	// httpClient fetches webpages; nil means http.DefaultClient
+	httpClient *http.Client
+	
+	// cache holds recent answers; nil when the response cache is off
+	cache *cache.Store
+	
+	// profile is the profile the handler was made for, or an empty string
+	// for the default profile, and profileNames lists the others
+	profile      string
+	profileNames []string
+	
+	// profiles switches to other profiles and reloads the configuration
+	// when it changes; nil when neither is possible
+	profiles *profileSwitcher
+	
+	// config is the configuration in use. Reloading it replaces the
+	// settings taken from it, which the UI never does while a command runs.
+	config config.Config
+	
+	// mutex guards the active persona, which the UI reads while commands
+	// run in the background
+	mutex   sync.Mutex
+	persona string
 }
 
 // NewHandler creates a new command handler
 func NewHandler(cfg config.Config) *Handler {
-	return &Handler{
-		claudeClient: api.NewClient(cfg),
+	return NewHandlerWithHTTPClient(cfg, nil)
+}
+
+// NewHandlerWithHTTPClient creates a command handler whose Claude client sends
+// every request through httpClient, such as one recording or replaying a
+// cassette, as are the webpages it fetches. A nil httpClient means
+// http.DefaultClient.
+func NewHandlerWithHTTPClient(cfg config.Config, httpClient *http.Client) *Handler {
+	// Keep daily usage totals alongside the rest of the profile's local
+	// files, or in memory only if there is nowhere to put them
+	var usageDir string
+	if cfg.DataDir != "" {
+		usageDir = filepath.Join(cfg.DataDir, "usage")
+	}
+	tracker := usage.NewTracker(usageDir)
+	
+	client := api.NewClientWithHTTPClient(cfg, httpClient)
+	client.Usage = tracker
+	
+	responseCache := newResponseCache(cfg)
+	client.Cache = responseCache
+	
+	h := &Handler{
+		llm:          client,
+		conversation: api.NewConversation(),
+		usage:        tracker,
+		attachments:  &attachmentQueue{},
+		prompts:      cfg.Prompts,
+		persona:      cfg.Prompts.Persona,
+		httpClient:   httpClient,
+		cache:        responseCache,
+		profile:      cfg.Profile,
+		profileNames: cfg.Profiles,
+		config:       cfg,
 	}
+	
+	// Keep track of submitted batches alongside usage, so they can be picked
+	// up again after a restart
+	if cfg.Backend != config.BackendOpenAI {
+		var batchDir string
+		if cfg.DataDir != "" {
+			batchDir = filepath.Join(cfg.DataDir, "batches")
+		}
+		// Carrying on without the saved jobs would lose track of batches
+		// still in progress, so a job that cannot be read is reported
+		// instead
+		if manager, err := batch.NewManager(client, batchDir); err == nil {
+			h.batches = manager
+		} else {
+			h.batchErr = err
+		}
+	}
+	
+	return h
+}
+
+// newResponseCache keeps recent answers on disk when asked to, so that
+// repeating a request shortly afterwards costs nothing. It returns nil when
+// the response cache is off.
+func newResponseCache(cfg config.Config) *cache.Store {
+	if !cfg.Cache.Enabled || cfg.Cache.TTL <= 0 || cfg.DataDir == "" {
+		return nil
+	}
+	return cache.New(filepath.Join(cfg.DataDir, "cache"), cfg.Cache.TTL, cfg.Cache.MaxBytes)
+}
+
+// NewHandlerWithLLM creates a command handler that sends prompts to llm, such
+// as a scripted fake from the apitest package. Usage is tracked in memory only,
+// as are batches when llm can run them.
+func NewHandlerWithLLM(llm api.LLM) *Handler {
+	h := &Handler{
+		llm:          llm,
+		conversation: api.NewConversation(),
+		usage:        usage.NewTracker(""),
+		attachments:  &attachmentQueue{},
+		prompts:      config.DefaultPrompts(),
+	}
+	if batches, ok := llm.(batch.API); ok {
+		h.batches, _ = batch.NewManager(batches, "")
+	}
+	return h
+}
+
+// UsageSummary describes the tokens used and their cost so far this session
+func (h *Handler) UsageSummary() string {
+	return h.usage.Summary()
 }
 
 // ProcessCommand handles different types of user commands
-func (h *Handler) ProcessCommand(command string) (string, error) {
+func (h *Handler) ProcessCommand(ctx context.Context, command string) (*Result, error) {
+	return h.ProcessCommandStream(ctx, command, nil)
+}
+
+// ProcessCommandStream handles a user command like ProcessCommand, passing
+// Claude's response text to onDelta as it is generated when onDelta is non-nil
+func (h *Handler) ProcessCommandStream(ctx context.Context, command string, onDelta api.StreamFunc) (*Result, error) {
+	// Keep the provider results the answer is based on, and account for the
+	// tokens used to get it
+	var sources []mcp.Call
+	var mutex sync.Mutex
+	ctx = mcp.WithTrace(ctx, func(call mcp.Call) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		sources = append(sources, call)
+	})
+	before := h.usage.Session()
+	
+	result, err := h.processCommand(ctx, command, onDelta)
+	if err != nil {
+		return nil, err
+	}
+	
+	mutex.Lock()
+	result.Sources = sources
+	mutex.Unlock()
+	result.Usage = h.usage.Session().Since(before)
+	return result, nil
+}
+
+// processCommand picks the handler for a command
+func (h *Handler) processCommand(ctx context.Context, command string, onDelta api.StreamFunc) (*Result, error) {
 	command = strings.TrimSpace(command)
 	
 	if command == "exit" {
-		return "Exiting...", nil
+		return textResult("Exiting..."), nil
+	}
+	
+	// Forget the conversation so far
+	if command == "/new" {
+		h.conversation.Reset()
+		return textResult("Started a new conversation."), nil
+	}
+	
+	// Break down the session's spend by handler
+	if command == "/usage" {
+		return textResult(h.usage.Report()), nil
+	}
+	
+	// Show or empty the response cache
+	if command == "/cache" || strings.HasPrefix(command, "/cache ") {
+		return h.handleCache(strings.TrimSpace(strings.TrimPrefix(command, "/cache"))), nil
+	}
+	
+	// Queue images and PDFs for the next prompt
+	if command == "/attach" || strings.HasPrefix(command, "/attach ") {
+		return h.handleAttach(strings.TrimSpace(strings.TrimPrefix(command, "/attach"))), nil
+	}
+	
+	// Summarise a backlog in bulk
+	if command == "/batch" || strings.HasPrefix(command, "/batch ") {
+		return h.handleBatch(ctx, strings.TrimSpace(strings.TrimPrefix(command, "/batch")))
+	}
+	
+	// List or switch profiles
+	if command == "/profile" || strings.HasPrefix(command, "/profile ") {
+		return h.handleProfile(strings.TrimSpace(strings.TrimPrefix(command, "/profile"))), nil
+	}
+	
+	// Switch the style Claude answers in
+	if command == "/persona" || strings.HasPrefix(command, "/persona ") {
+		return h.handlePersona(strings.TrimSpace(strings.TrimPrefix(command, "/persona"))), nil
 	}
 	
 	// Check if it's an email command
 	if strings.Contains(command, "unread emails") || strings.Contains(command, "unread e-mails") {
-		return h.HandleEmailSummary()
+		return h.HandleEmailSummary(ctx, onDelta)
 	} else if strings.HasPrefix(command, "what's on this webpage?") || 
 	          strings.HasPrefix(command, "what's on this webpage") {
 		parts := strings.SplitN(command, "?", 2)
@@ -47,12 +241,12 @@ func (h *Handler) ProcessCommand(command string) (string, error) {
 		}
 		
 		if url != "" {
-			return h.HandleWebpageSummary(url)
+			return h.HandleWebpageSummary(ctx, url, onDelta)
 		}
-		return "Please provide a URL to summarize.", nil
+		return textResult("Please provide a URL to summarize."), nil
 	} else if strings.HasPrefix(command, "list slack channels") || strings.HasPrefix(command, "show slack channels") {
 		// List available Slack channels
-		return h.HandleSlackChannels()
+		return h.HandleSlackChannels(ctx)
 	} else if strings.Contains(command, "summarize slack channel") || strings.Contains(command, "summarise slack channel") {
 		// Extract channel name or ID
 		var channel string
@@ -79,25 +273,54 @@ func (h *Handler) ProcessCommand(command string) (string, error) {
 		}
 		
 		if channel != "" {
-			return h.HandleSlackSummary(channel)
+			return h.HandleSlackSummary(ctx, channel, onDelta)
 		}
-		return "Please specify a Slack channel name or ID to summarize.", nil
+		return textResult("Please specify a Slack channel name or ID to summarize."), nil
 	} else {
-		// For any other command, pass it directly to Claude
-		response, err := h.claudeClient.Ask(command)
+		// For any other command, pass it to Claude, which can call on the
+		// registered providers itself
+		response, err := h.chat(ctx, api.TaskChat, command, onDelta)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		return response, nil
 	}
 }
 
+// chat sends a prompt for a task to Claude as the next turn of the
+// conversation, offering every registered provider command as a tool. Any
+// queued attachments go with it, and stay queued if the request fails.
+func (h *Handler) chat(ctx context.Context, task string, prompt string, onDelta api.StreamFunc) (*Result, error) {
+	attachments := h.attachments.blocks()
+	response, err := h.llm.Send(ctx, api.ChatRequest{
+		Task:         task,
+		Prompt:       prompt,
+		System:       h.systemPrompt(task),
+		Conversation: h.conversation,
+		Tools:        mcp.Tools(),
+		RunTool:      mcp.ExecuteTool,
+		Attachments:  attachments,
+		OnDelta:      onDelta,
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.attachments.remove(len(attachments))
+	
+	return &Result{
+		Text:      response.Text,
+		Truncated: response.Truncated,
+		Thinking:  response.Thinking,
+		Cached:    response.Cached,
+	}, nil
+}
+
 // HandleWebpageSummary creates a summary of a webpage
-func (h *Handler) HandleWebpageSummary(url string) (string, error) {
+func (h *Handler) HandleWebpageSummary(ctx context.Context, url string, onDelta api.StreamFunc) (*Result, error) {
 	// Fetch webpage content
-	content, err := h.fetchWebpage(url)
+	content, err := h.fetchWebpage(ctx, url)
 	if err != nil {
-		return "", fmt.Errorf("error fetching webpage: %v", err)
+		return nil, fmt.Errorf("error fetching webpage: %v", err)
 	}
 	
 	// Truncate content if it's too long
@@ -107,17 +330,29 @@ func (h *Handler) HandleWebpageSummary(url string) (string, error) {
 	
 	prompt := fmt.Sprintf("Please summarize the content of this webpage from %s:\n\n%s", url, content)
 	
-	return h.claudeClient.Ask(prompt)
+	return h.chat(ctx, api.TaskWebpage, prompt, onDelta)
 }
 
-// fetchWebpage retrieves content from a URL
-func (h *Handler) fetchWebpage(url string) (string, error) {
+// fetchWebpage retrieves content from a URL, giving up after webpageTimeout
+func (h *Handler) fetchWebpage(ctx context.Context, url string) (string, error) {
 	// Add http:// prefix if not present
 	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
 		url = "https://" + url
 	}
 	
-	resp, err := http.Get(url)
+	ctx, cancel := context.WithTimeout(ctx, webpageTimeout)
+	defer cancel()
+	
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	
+	client := h.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
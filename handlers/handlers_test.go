@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"terminal-claude/api/apitest"
+	"terminal-claude/config"
+	"terminal-claude/mcp"
+)
+
+// notesProvider is a provider whose one command returns canned notes
+type notesProvider struct{}
+
+func (notesProvider) Name() string { return "Notes" }
+
+func (notesProvider) GetCapabilities() []mcp.Capability {
+	return []mcp.Capability{{
+		Name:        "notes",
+		Description: "Read notes",
+		Commands:    []string{"list"},
+		CommandInfo: map[string]mcp.CommandInfo{
+			"list": {Description: "List notes", Parameters: []mcp.Parameter{{Name: "tag", Type: "string", Description: "Tag to filter by"}}},
+		},
+	}}
+}
+
+func (notesProvider) Execute(ctx context.Context, command string, params map[string]interface{}) (interface{}, error) {
+	return map[string]interface{}{"notes": []string{"buy milk"}, "tag": params["tag"]}, nil
+}
+
+func TestChatContinuesConversation(t *testing.T) {
+	fake := apitest.NewFake(
+		apitest.Reply{Text: "Go is a programming language."},
+		apitest.Reply{Text: "It was released in 2009."},
+	)
+	h := NewHandlerWithLLM(fake)
+
+	var streamed strings.Builder
+	result, err := h.ProcessCommandStream(context.Background(), "tell me about golang", func(delta string) {
+		streamed.WriteString(delta)
+	})
+	if err != nil {
+		t.Fatalf("first command: %v", err)
+	}
+	if result.Text != "Go is a programming language." {
+		t.Errorf("text = %q", result.Text)
+	}
+	if streamed.String() != result.Text {
+		t.Errorf("streamed %q, want %q", streamed.String(), result.Text)
+	}
+
+	result, err = h.ProcessCommand(context.Background(), "when was it released?")
+	if err != nil {
+		t.Fatalf("second command: %v", err)
+	}
+	if result.Text != "It was released in 2009." {
+		t.Errorf("text = %q", result.Text)
+	}
+
+	prompts := fake.Prompts()
+	if len(prompts) != 2 || prompts[0] != "tell me about golang" || prompts[1] != "when was it released?" {
+		t.Errorf("prompts = %q", prompts)
+	}
+	if n := h.conversation.Len(); n != 4 {
+		t.Errorf("conversation has %d messages, want 4", n)
+	}
+	if fake.Remaining() != 0 {
+		t.Errorf("%d scripted replies left", fake.Remaining())
+	}
+}
+
+func TestChatRunsProviderTools(t *testing.T) {
+	mcp.Register(notesProvider{})
+	t.Cleanup(mcp.Reset)
+
+	fake := apitest.NewFake(
+		apitest.Reply{ToolCalls: []apitest.ToolCall{{Name: "Notes__list", Input: map[string]interface{}{"tag": "home"}}}},
+		apitest.Reply{Text: "You need to buy milk."},
+	)
+	h := NewHandlerWithLLM(fake)
+
+	result, err := h.ProcessCommand(context.Background(), "what do I need to do at home?")
+	if err != nil {
+		t.Fatalf("command: %v", err)
+	}
+	if result.Text != "You need to buy milk." {
+		t.Errorf("text = %q", result.Text)
+	}
+
+	offered := false
+	for _, tool := range fake.Requests()[0].Tools {
+		offered = offered || tool.Name == "Notes__list"
+	}
+	if !offered {
+		t.Errorf("Notes__list was not offered as a tool")
+	}
+
+	results := fake.ToolResults()
+	if len(results) != 1 {
+		t.Fatalf("%d tool results, want 1", len(results))
+	}
+	if results[0].Err != nil {
+		t.Fatalf("tool failed: %v", results[0].Err)
+	}
+	if !strings.Contains(results[0].Output, "buy milk") || !strings.Contains(results[0].Output, `"tag":"home"`) {
+		t.Errorf("tool output = %s", results[0].Output)
+	}
+}
+
+func TestChatReportsScriptedError(t *testing.T) {
+	fake := apitest.NewFake(apitest.Reply{Err: context.DeadlineExceeded})
+	h := NewHandlerWithLLM(fake)
+
+	if _, err := h.ProcessCommand(context.Background(), "hello"); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := h.conversation.Len(); n != 0 {
+		t.Errorf("failed exchange was remembered: %d messages", n)
+	}
+}
+
+func TestBatchReportsUnreadableJobs(t *testing.T) {
+	dataDir := t.TempDir()
+	batchDir := filepath.Join(dataDir, "batches")
+	if err := os.MkdirAll(batchDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(batchDir, "msgbatch_1.json"), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(config.Config{Backend: config.BackendAnthropic, AnthropicAPIKey: "test-key", DataDir: dataDir})
+	result, err := h.ProcessCommand(context.Background(), "/batch")
+	if err != nil {
+		t.Fatalf("command: %v", err)
+	}
+	if !strings.Contains(result.Text, "msgbatch_1.json") {
+		t.Errorf("text = %q, want the unreadable job named", result.Text)
+	}
+}
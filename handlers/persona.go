@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Persona returns the name of the active persona, or an empty string
+func (h *Handler) Persona() string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.persona
+}
+
+// systemPrompt returns the system prompt for a task with the active persona
+func (h *Handler) systemPrompt(task string) string {
+	return h.prompts.SystemPrompt(task, h.Persona())
+}
+
+// handlePersona handles the /persona command: "/persona <name>" switches to a
+// persona, "/persona off" goes back to the plain system prompt and a bare
+// "/persona" lists the personas
+func (h *Handler) handlePersona(args string) *Result {
+	switch args {
+	case "":
+		active := h.Persona()
+		var b strings.Builder
+		b.WriteString("Personas:\n")
+		for _, name := range h.prompts.PersonaNames() {
+			marker := "  "
+			if name == active {
+				marker = "* "
+			}
+			b.WriteString(marker + name)
+			if description := h.prompts.Personas[name].Description; description != "" {
+				b.WriteString(" - " + description)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\nUse /persona <name> to switch, or /persona off for none.")
+		return textResult(b.String())
+	case "off", "none":
+		h.mutex.Lock()
+		h.persona = ""
+		h.mutex.Unlock()
+		return textResult("Persona switched off.")
+	}
+
+	if _, ok := h.prompts.Personas[args]; !ok {
+		return textResult(fmt.Sprintf("Unknown persona %q. Available personas: %s",
+			args, strings.Join(h.prompts.PersonaNames(), ", ")))
+	}
+
+	h.mutex.Lock()
+	h.persona = args
+	h.mutex.Unlock()
+	return textResult(fmt.Sprintf("Switched to the %s persona.", args))
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"terminal-claude/config"
+)
+
+// ProfileLoader reads the configuration of profiles and starts their
+// providers
+type ProfileLoader interface {
+	// Load reads the configuration of a profile, failing if it is invalid
+	Load(name string) (config.Config, error)
+
+	// StartProviders registers the providers of a configuration in place of
+	// the current ones, returning warnings about any that could not be
+	// started. When keep is set, as when reloading the profile in use, a
+	// provider that cannot be started leaves the running one in its place.
+	StartProviders(cfg config.Config, keep bool) []string
+}
+
+// profileSwitcher keeps a handler for every profile switched to, so that
+// switching back picks up its conversation where it was left
+type profileSwitcher struct {
+	loader   ProfileLoader
+	watcher  *fileWatcher
+	mutex    sync.Mutex
+	handlers map[string]*Handler
+}
+
+// EnableProfiles lets /profile switch between the profiles in the config
+// file, and ReloadIfChanged apply changes to it and the secret store, using
+// loader to read them
+func (h *Handler) EnableProfiles(loader ProfileLoader) {
+	paths := []string{h.config.Path}
+	if h.config.Secrets != nil {
+		paths = append(paths, h.config.Secrets.Path())
+	}
+	h.profiles = &profileSwitcher{
+		loader:   loader,
+		watcher:  newFileWatcher(paths...),
+		handlers: map[string]*Handler{h.Profile(): h},
+	}
+}
+
+// Profile returns the name of the handler's profile
+func (h *Handler) Profile() string {
+	if h.profile == "" {
+		return config.DefaultProfile
+	}
+	return h.profile
+}
+
+// handleProfile handles the /profile command: "/profile switch <name>"
+// switches to a profile and a bare "/profile" lists them
+func (h *Handler) handleProfile(args string) *Result {
+	if args == "" {
+		active := h.Profile()
+		var b strings.Builder
+		b.WriteString("Profiles:\n")
+		for _, name := range append([]string{config.DefaultProfile}, h.profileNames...) {
+			marker := "  "
+			if name == active {
+				marker = "* "
+			}
+			b.WriteString(marker + name + "\n")
+		}
+		b.WriteString("\nUse /profile switch <name> to switch.")
+		return textResult(b.String())
+	}
+
+	name, ok := strings.CutPrefix(args, "switch ")
+	if !ok {
+		return textResult("Usage: /profile [switch <name>]")
+	}
+	return h.switchProfile(strings.TrimSpace(name))
+}
+
+// switchProfile reloads the configuration for a profile, registers its
+// providers and hands over to the profile's handler
+func (h *Handler) switchProfile(name string) *Result {
+	if h.profiles == nil {
+		return textResult("Profiles cannot be switched here.")
+	}
+	if name == h.Profile() {
+		return textResult(fmt.Sprintf("Already using the %s profile.", name))
+	}
+
+	cfg, err := h.profiles.loader.Load(name)
+	if err != nil {
+		return textResult(fmt.Sprintf("Unable to switch to the %s profile: %v", name, err))
+	}
+	// Another profile's providers act for another account, so none are kept
+	warnings := h.profiles.startProviders(cfg, false)
+
+	h.profiles.mutex.Lock()
+	next, resumed := h.profiles.handlers[name]
+	if !resumed {
+		next = NewHandlerWithHTTPClient(cfg, h.httpClient)
+		next.profiles = h.profiles
+		h.profiles.handlers[name] = next
+	}
+	h.profiles.mutex.Unlock()
+
+	// A profile switched back to may have changed in the meantime
+	next.apply(cfg)
+
+	text := fmt.Sprintf("Switched to the %s profile.", name)
+	if resumed {
+		text = fmt.Sprintf("Switched back to the %s profile and its conversation.", name)
+	}
+	return &Result{Text: text, Warnings: warnings, Handler: next}
+}
+
+// startProviders registers the providers of cfg, keeping running ones that
+// fail to restart when keep is set, then forgets the changes they made to
+// the watched files themselves, such as saving a new token, so that they
+// are not taken for changes to reload
+func (p *profileSwitcher) startProviders(cfg config.Config, keep bool) []string {
+	warnings := p.loader.StartProviders(cfg, keep)
+	p.watcher.changed()
+	return warnings
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"terminal-claude/api"
+	"terminal-claude/config"
+	"terminal-claude/mcp"
+	"time"
+)
+
+// fileWatcher notices when files are written, replaced or removed by
+// comparing their size and modification time between checks
+type fileWatcher struct {
+	stamps map[string]fileStamp
+}
+
+// fileStamp is what a file looked like when it was last checked
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// newFileWatcher starts watching paths, ignoring empty ones
+func newFileWatcher(paths ...string) *fileWatcher {
+	w := &fileWatcher{stamps: map[string]fileStamp{}}
+	for _, path := range paths {
+		if path != "" {
+			w.stamps[path] = stampOf(path)
+		}
+	}
+	return w
+}
+
+// changed returns the files that have changed since the last check
+func (w *fileWatcher) changed() map[string]bool {
+	changed := map[string]bool{}
+	for path, before := range w.stamps {
+		if now := stampOf(path); now != before {
+			w.stamps[path] = now
+			changed[path] = true
+		}
+	}
+	return changed
+}
+
+// stampOf describes a file as it is now
+func stampOf(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// ReloadIfChanged reads the configuration again when the config file or the
+// secret store has changed since it was last read, and applies it to the
+// Claude client, the handler and, when their settings or tokens may have
+// changed, the providers. It returns a notice describing what happened, or
+// an empty string when nothing changed, along with warnings about providers
+// that could not be restarted. An invalid configuration is not applied, so
+// the settings already in use stay in place.
+func (h *Handler) ReloadIfChanged() (string, []string) {
+	if h.profiles == nil {
+		return "", nil
+	}
+	changed := h.profiles.watcher.changed()
+	if len(changed) == 0 {
+		return "", nil
+	}
+
+	previous := h.config
+	secretsChanged := previous.Secrets != nil && changed[previous.Secrets.Path()]
+	if secretsChanged {
+		if err := previous.Secrets.Refresh(); err != nil {
+			return fmt.Sprintf("The secret store changed but could not be read, so the secrets already loaded are still in use: %v", err), nil
+		}
+	}
+
+	cfg, err := h.profiles.loader.Load(h.Profile())
+	if err != nil {
+		return fmt.Sprintf("The config change was not applied, so the previous settings are still in use:\n%v", err), nil
+	}
+
+	var warnings []string
+	restart := secretsChanged || cfg.Gmail != previous.Gmail || cfg.Slack != previous.Slack
+	if restart {
+		warnings = h.profiles.startProviders(cfg, true)
+	}
+
+	changes := h.apply(cfg)
+	if restart {
+		changes = append(changes, "providers restarted")
+	}
+	if len(changes) == 0 {
+		return "Config reloaded; nothing used by this session changed.", warnings
+	}
+	return "Config reloaded: " + strings.Join(changes, ", ") + ".", warnings
+}
+
+// apply switches the handler, its Claude client and the provider cache to
+// cfg, returning descriptions of the settings that changed
+func (h *Handler) apply(cfg config.Config) []string {
+	previous := h.config
+	changes := describeChanges(previous, cfg)
+
+	responseCache := h.cache
+	if cfg.Cache.Enabled != previous.Cache.Enabled || cfg.Cache.TTL != previous.Cache.TTL ||
+		cfg.Cache.MaxBytes != previous.Cache.MaxBytes || cfg.DataDir != previous.DataDir {
+		responseCache = newResponseCache(cfg)
+	}
+	if client, ok := h.llm.(*api.Client); ok {
+		client.Reconfigure(cfg, responseCache)
+	}
+	h.cache = responseCache
+	h.prompts = cfg.Prompts
+	h.profileNames = cfg.Profiles
+	h.config = cfg
+
+	// The starting persona only replaces the one in use when it was changed
+	if cfg.Prompts.Persona != previous.Prompts.Persona {
+		h.mutex.Lock()
+		h.persona = cfg.Prompts.Persona
+		h.mutex.Unlock()
+	}
+
+	if cfg.Cache.Enabled {
+		mcp.SetCachePolicy(cfg.Cache.ProviderTTLFor)
+	} else {
+		mcp.SetCachePolicy(nil)
+	}
+	return changes
+}
+
+// describeChanges lists the settings that differ between two configurations
+func describeChanges(before config.Config, after config.Config) []string {
+	var changes []string
+	changed := func(name string, from interface{}, to interface{}) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s %v → %v", name, from, to))
+		}
+	}
+	changed("backend", before.Backend, after.Backend)
+	changed("model", before.Model, after.Model)
+	changed("max tokens", before.MaxTokens, after.MaxTokens)
+	changed("continuations", before.MaxContinuations, after.MaxContinuations)
+	changed("thinking budget", before.ThinkingBudget, after.ThinkingBudget)
+	changed("prompt caching", before.PromptCaching, after.PromptCaching)
+	changed("persona", personaName(before.Prompts.Persona), personaName(after.Prompts.Persona))
+
+	if before.AnthropicAPIKey != after.AnthropicAPIKey || before.OpenAIAPIKey != after.OpenAIAPIKey {
+		changes = append(changes, "API key")
+	}
+	if before.AnthropicBaseURL != after.AnthropicBaseURL || before.OpenAIBaseURL != after.OpenAIBaseURL {
+		changes = append(changes, "API address")
+	}
+	if !reflect.DeepEqual(before.Routes, after.Routes) {
+		changes = append(changes, "task routes")
+	}
+	if before.Prompts.System != after.Prompts.System || !reflect.DeepEqual(before.Prompts.Tasks, after.Prompts.Tasks) ||
+		!reflect.DeepEqual(before.Prompts.Personas, after.Prompts.Personas) {
+		changes = append(changes, "system prompts")
+	}
+	if !reflect.DeepEqual(before.Cache, after.Cache) {
+		changes = append(changes, "response cache")
+	}
+	return changes
+}
+
+// personaName describes a starting persona, which may be none
+func personaName(persona string) string {
+	if persona == "" {
+		return "none"
+	}
+	return persona
+}
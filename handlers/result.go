@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"terminal-claude/mcp"
+	"terminal-claude/usage"
+)
+
+// Result is the outcome of processing a command. It is encoded as JSON for
+// prodterm ask --output json.
+type Result struct {
+	// Text is the response to show the user
+	Text string `json:"text"`
+
+	// Truncated is set when Claude's answer was still cut off by the token
+	// limit after every allowed continuation
+	Truncated bool `json:"truncated"`
+
+	// Thinking is Claude's reasoning, when extended thinking is enabled
+	Thinking string `json:"thinking,omitempty"`
+
+	// Cached is set when Claude's answer was reused from the response cache
+	Cached bool `json:"cached"`
+
+	// ActionItems and Questions are picked out of email and Slack summaries
+	ActionItems []ActionItem `json:"action_items,omitempty"`
+	Questions   []string     `json:"questions,omitempty"`
+
+	// Warnings describe parts of the command that failed without spoiling
+	// the rest of the result
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Sources are the provider commands run for the answer, by the handler
+	// or by Claude as tools, with the results mcp.ExecuteCommand returned
+	Sources []mcp.Call `json:"sources,omitempty"`
+
+	// Usage is the tokens the command used and their cost
+	Usage usage.Totals `json:"usage"`
+
+	// Handler, when set, takes over from the handler that ran the command,
+	// as it does after switching profiles
+	Handler *Handler `json:"-"`
+}
+
+// textResult wraps a response that did not come from Claude
+func textResult(text string) *Result {
+	return &Result{Text: text}
+}
+
+// Triage renders the action items and questions as a checklist, or returns
+// an empty string when there are none
+func (r *Result) Triage() string {
+	return formatTriage(r.ActionItems, r.Questions)
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"terminal-claude/api"
 	"terminal-claude/mcp"
+	"terminal-claude/secrets"
 )
 
 // HandleSlackSummary summarizes recent messages from a Slack channel
-func (h *Handler) HandleSlackSummary(channel string) (string, error) {
+func (h *Handler) HandleSlackSummary(ctx context.Context, channel string, onDelta api.StreamFunc) (*Result, error) {
 	// Determine if input is a channel ID or name
 	var params map[string]interface{}
 	if strings.HasPrefix(channel, "C") && len(channel) == 9 {
@@ -25,32 +29,49 @@ func (h *Handler) HandleSlackSummary(channel string) (string, error) {
 	}
 
 	// Get the Slack provider to summarize the channel
-	result, err := mcp.ExecuteCommand("Slack", "summarize_channel", params)
+	result, err := mcp.ExecuteCommand(ctx, "Slack", "summarize_channel", params)
 	if err != nil {
 		// Check if this is a provider not found error and provide helpful instructions
-		if strings.Contains(err.Error(), "provider not found") {
-			return "", fmt.Errorf("Slack integration is not configured. Please see docs/slack_setup.md for setup instructions")
+		if errors.Is(err, mcp.ErrProviderNotFound) {
+			return nil, fmt.Errorf("Slack integration is not configured (%w). Please see docs/slack_setup.md for setup instructions", err)
 		}
 		
 		// For authentication errors
 		if strings.Contains(err.Error(), "authentication") || strings.Contains(err.Error(), "token") {
-			return "", fmt.Errorf("Slack authentication failed. Please check your token in ~/.config/terminal-claude/slack_token.txt")
+			return nil, h.slackAuthError()
 		}
 		
-		return "", fmt.Errorf("failed to summarize Slack channel: %v", err)
+		return nil, fmt.Errorf("failed to summarize Slack channel: %w", err)
 	}
 
 	// Convert result to a format we can use
 	summary, ok := result.(map[string]interface{})
 	if !ok {
-		return "", fmt.Errorf("unexpected result type")
+		return nil, fmt.Errorf("unexpected result type")
 	}
 
+	channelName, channelData, ok := formatChannelMessages(summary)
+	if !ok {
+		return textResult(fmt.Sprintf("No recent messages found in #%s", channelName)), nil
+	}
+
+	response, err := h.chat(ctx, api.TaskSlack, slackSummaryPrompt(channelData), onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.withTriage(ctx, api.TaskSlack, channelData, response)
+}
+
+// formatChannelMessages formats the result of the Slack provider's
+// summarize_channel command for Claude. It reports false if the channel had
+// no recent messages.
+func formatChannelMessages(summary map[string]interface{}) (string, string, bool) {
 	channelName, _ := summary["channel_name"].(string)
 	messages, _ := summary["messages"].([]map[string]interface{})
 
 	if len(messages) == 0 {
-		return fmt.Sprintf("No recent messages found in #%s", channelName), nil
+		return channelName, "", false
 	}
 
 	// Format the channel data for Claude
@@ -65,42 +86,45 @@ func (h *Handler) HandleSlackSummary(channel string) (string, error) {
 			i+1, user, timeAgo, text)
 	}
 
-	prompt := fmt.Sprintf("Here are recent messages from a Slack channel. Please provide:\n"+
+	return channelName, channelData, true
+}
+
+// slackSummaryPrompt asks Claude to summarise formatted channel messages
+func slackSummaryPrompt(channelData string) string {
+	return fmt.Sprintf("Here are recent messages from a Slack channel. Please provide:\n"+
 		"1. A concise summary of the main topics and discussions\n"+
 		"2. Any important decisions or action items\n"+
 		"3. Any questions that appear to need answers\n\n%s", channelData)
-
-	return h.claudeClient.Ask(prompt)
 }
 
 // HandleSlackChannels lists available Slack channels
-func (h *Handler) HandleSlackChannels() (string, error) {
+func (h *Handler) HandleSlackChannels(ctx context.Context) (*Result, error) {
 	// Get the Slack provider to list channels
-	result, err := mcp.ExecuteCommand("Slack", "list_channels", map[string]interface{}{})
+	result, err := mcp.ExecuteCommand(ctx, "Slack", "list_channels", map[string]interface{}{})
 	if err != nil {
 		// Check if this is a provider not found error and provide helpful instructions
-		if strings.Contains(err.Error(), "provider not found") {
-			return "", fmt.Errorf("Slack integration is not configured. Please see docs/slack_setup.md for setup instructions")
+		if errors.Is(err, mcp.ErrProviderNotFound) {
+			return nil, fmt.Errorf("Slack integration is not configured (%w). Please see docs/slack_setup.md for setup instructions", err)
 		}
 		
 		// For authentication errors
 		if strings.Contains(err.Error(), "authentication") || strings.Contains(err.Error(), "token") {
-			return "", fmt.Errorf("Slack authentication failed. Please check your token in ~/.config/terminal-claude/slack_token.txt")
+			return nil, h.slackAuthError()
 		}
 		
-		return "", fmt.Errorf("failed to list Slack channels: %v", err)
+		return nil, fmt.Errorf("failed to list Slack channels: %w", err)
 	}
 
 	// Convert result to a format we can use
 	channelList, ok := result.(map[string]interface{})
 	if !ok {
-		return "", fmt.Errorf("unexpected result type")
+		return nil, fmt.Errorf("unexpected result type")
 	}
 
 	channels, _ := channelList["channels"].([]map[string]interface{})
 
 	if len(channels) == 0 {
-		return "No Slack channels found.", nil
+		return textResult("No Slack channels found."), nil
 	}
 
 	// Format the channel list
@@ -120,5 +144,18 @@ func (h *Handler) HandleSlackChannels() (string, error) {
 		}
 	}
 
-	return response, nil
-}
\ No newline at end of file
+	// Remember the list so follow-up questions can refer to it
+	h.conversation.Record("List my Slack channels.", response)
+
+	return textResult(response), nil
+}
+
+// slackAuthError tells the user how to replace a Slack token that was
+// refused, which lives in the secret store under the profile's name
+func (h *Handler) slackAuthError() error {
+	name := h.config.Slack.TokenSecret
+	if name == "" {
+		name = secrets.SlackToken
+	}
+	return fmt.Errorf("Slack authentication failed. Store a new token with prodterm secrets set %s, or run prodterm doctor", name)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"terminal-claude/api"
+	"time"
+)
+
+// ActionItem is something that needs doing, picked out of emails or Slack
+// messages
+type ActionItem struct {
+	Task   string `json:"task" description:"What needs to be done, as a short imperative sentence"`
+	Owner  string `json:"owner,omitempty" description:"Who is expected to do it, if anyone is named or clearly implied; \"me\" for the reader"`
+	Due    string `json:"due,omitempty" description:"When it is due, as YYYY-MM-DD, if a date or deadline is given"`
+	Source string `json:"source,omitempty" description:"The email subject or the author of the Slack message it comes from"`
+}
+
+// Triage is the machine-readable part of an email or Slack summary
+type Triage struct {
+	ActionItems []ActionItem `json:"action_items" description:"Tasks that someone has been asked or has agreed to do"`
+	Questions   []string     `json:"questions" description:"Questions that were asked and still appear to need an answer"`
+}
+
+// extractTriage picks the action items and open questions out of the same
+// data a summary was written from
+func (h *Handler) extractTriage(ctx context.Context, task string, data string) (*Triage, error) {
+	prompt := fmt.Sprintf("Today is %s. List the action items and unanswered questions in the following. "+
+		"Leave out anything that is only informational, and leave owner and due empty rather than guessing.\n\n%s",
+		time.Now().Format("Monday 2006-01-02"), data)
+
+	var triage Triage
+	err := h.llm.Extract(ctx, api.ExtractRequest{
+		Task:        task,
+		Prompt:      prompt,
+		System:      h.systemPrompt(task),
+		Name:        "record_triage",
+		Description: "Record the action items and open questions found in the messages",
+	}, &triage)
+	if err != nil {
+		return nil, err
+	}
+	return &triage, nil
+}
+
+// withTriage adds the action items and questions in data to a summary. The
+// summary is still worth showing if they cannot be extracted, so failure is
+// reported as a warning unless the request was cancelled.
+func (h *Handler) withTriage(ctx context.Context, task string, data string, result *Result) (*Result, error) {
+	triage, err := h.extractTriage(ctx, task, data)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Could not extract action items: %v", err))
+		return result, nil
+	}
+
+	result.ActionItems = triage.ActionItems
+	result.Questions = triage.Questions
+	return result, nil
+}
+
+// formatTriage renders action items and questions as a plain text checklist
+func formatTriage(items []ActionItem, questions []string) string {
+	var b strings.Builder
+
+	if len(items) > 0 {
+		b.WriteString("Action items:\n")
+		for _, item := range items {
+			b.WriteString("- [ ] " + item.Task)
+
+			var details []string
+			if item.Owner != "" {
+				details = append(details, item.Owner)
+			}
+			if item.Due != "" {
+				details = append(details, "due "+item.Due)
+			}
+			if item.Source != "" {
+				details = append(details, "from "+item.Source)
+			}
+			if len(details) > 0 {
+				b.WriteString(" (" + strings.Join(details, ", ") + ")")
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(questions) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("Open questions:\n")
+		for _, question := range questions {
+			b.WriteString("- " + question + "\n")
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -1,62 +1,229 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 
+	"terminal-claude/cassette"
 	"terminal-claude/config"
+	"terminal-claude/handlers"
 	"terminal-claude/mcp"
 	"terminal-claude/providers/gmail"
 	"terminal-claude/providers/slack"
+	"terminal-claude/secrets"
 	"terminal-claude/ui"
 
 	tea "github.com/charmbracelet/bubbletea"
+	slackapi "github.com/slack-go/slack"
 )
 
+// replaySlackToken stands in for the Slack token when replaying a cassette,
+// which needs no credentials
+const replaySlackToken = "xoxb-replay"
+
 func main() {
+	// Commands that do not start the UI
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "secrets":
+			os.Exit(runSecrets(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		case "ask":
+			os.Exit(runAsk(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		}
+	}
+	
+	// Command line flags take precedence over the environment and config file
+	var flags config.Flags
+	flags.Register(flag.CommandLine)
+	flag.Parse()
+	
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.LoadWithFlags(flags)
 	if err != nil {
 		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	
+	log.Printf("Using model: %s", cfg.Model)
 
-	// Initialize providers
-	initializeProviders()
+	// Record every HTTP exchange to a cassette, or replay one recorded
+	// earlier, when asked to
+	transport, err := cassetteTransport(cfg)
+	if err != nil {
+		fmt.Printf("Error loading cassette: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize providers. Their log lines are hidden once the UI takes
+	// over the screen, so any that could not be started are also shown in
+	// the UI.
+	warnings := initializeProviders(cfg, transport)
+	setCachePolicy(cfg)
+
+	var httpClient *http.Client
+	if transport != nil {
+		httpClient = transport.Client()
+	}
 
 	// Start the UI
-	if err := tea.NewProgram(ui.InitialModel(cfg), tea.WithAltScreen()).Start(); err != nil {
+	handler := handlers.NewHandlerWithHTTPClient(cfg, httpClient)
+	program := tea.NewProgram(ui.InitialModelWithHandler(handler, warnings...), tea.WithAltScreen())
+	handler.EnableProfiles(profileLoader{flags: flags, vault: cfg.Secrets, transport: transport, program: program})
+	if err := program.Start(); err != nil {
 		fmt.Printf("Error starting application: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-// initializeProviders registers all MCP providers
-func initializeProviders() {
-	// Initialize Gmail provider
-	gmailProvider, err := gmail.New()
-	if err != nil {
-		log.Printf("Warning: Failed to initialize Gmail provider: %v", err)
-	} else {
-		mcp.Register(gmailProvider)
-		log.Println("Registered Gmail provider")
-	}
-	
-	// Note: Slack provider is auto-registered via its init() function
-	// Let's check if it was registered successfully
-	if _, err := mcp.Get("Slack"); err != nil {
-		log.Printf("Note: Slack provider not available: %v", err)
-		
-		// Try to register it manually as fallback
-		slackProvider, err := slack.New()
-		if err != nil {
-			log.Printf("Warning: Failed to initialize Slack provider: %v", err)
-		} else {
-			mcp.Register(slackProvider)
-			log.Println("Registered Slack provider")
+// cassetteTransport returns a transport recording to the cassette named by
+// PRODTERM_RECORD or replaying the one named by PRODTERM_REPLAY, or nil when
+// neither is set
+func cassetteTransport(cfg config.Config) (*cassette.Transport, error) {
+	secrets := []string{cfg.AnthropicAPIKey, cfg.OpenAIAPIKey}
+	
+	if path := os.Getenv("PRODTERM_REPLAY"); path != "" {
+		if os.Getenv("PRODTERM_RECORD") != "" {
+			return nil, fmt.Errorf("set only one of PRODTERM_RECORD and PRODTERM_REPLAY")
 		}
+		return cassette.NewReplayer(path, secrets...)
+	}
+	if path := os.Getenv("PRODTERM_RECORD"); path != "" {
+		return cassette.NewRecorder(path, nil, secrets...), nil
+	}
+	return nil, nil
+}
+
+// setCachePolicy reuses recent provider results when the response cache is
+// on
+func setCachePolicy(cfg config.Config) {
+	if cfg.Cache.Enabled {
+		mcp.SetCachePolicy(cfg.Cache.ProviderTTLFor)
 	} else {
-		log.Println("Slack provider is available")
+		mcp.SetCachePolicy(nil)
+	}
+}
+
+// profileLoader reads the configuration of profiles with the command line
+// flags the app was started with, and registers their providers while it
+// runs. The terminal is handed back whenever input may be needed, such as
+// the passphrase of the secret store or a Gmail authorisation code.
+type profileLoader struct {
+	flags     config.Flags
+	vault     *secrets.Vault
+	transport *cassette.Transport
+	program   *tea.Program
+}
+
+// Load reads the configuration of a profile
+func (l profileLoader) Load(name string) (config.Config, error) {
+	if l.vault.Locked() {
+		l.program.ReleaseTerminal()
+		defer l.program.RestoreTerminal()
 	}
+	
+	flags := l.flags
+	flags.Profile = name
+	return config.LoadWithSecrets(flags, l.vault)
+}
+
+// StartProviders starts the providers of cfg and registers them in place of
+// the current ones. The old providers keep running until the new ones have
+// started, and when keep is set one that fails to start leaves the old
+// provider of the same name in place.
+func (l profileLoader) StartProviders(cfg config.Config, keep bool) []string {
+	l.program.ReleaseTerminal()
+	defer l.program.RestoreTerminal()
+	
+	var providers []mcp.Provider
+	var warnings []string
+	for _, started := range startProviders(cfg, l.transport) {
+		if started.err == nil {
+			providers = append(providers, started.provider)
+			continue
+		}
+		if old, err := mcp.Get(started.name); keep && err == nil {
+			providers = append(providers, old)
+			warnings = append(warnings, fmt.Sprintf("%s could not be restarted, so the one already running is still in use: %v. Run prodterm doctor for a fix.", started.name, started.err))
+			continue
+		}
+		warnings = append(warnings, started.warning())
+	}
+	
+	mcp.Replace(providers...)
+	return warnings
+}
+
+// initializeProviders registers all MCP providers, sending their requests
+// through transport when it is not nil, and describes any that could not be
+// started
+func initializeProviders(cfg config.Config, transport *cassette.Transport) []string {
+	var warnings []string
+	for _, started := range startProviders(cfg, transport) {
+		if started.err != nil {
+			warnings = append(warnings, started.warning())
+			continue
+		}
+		mcp.Register(started.provider)
+	}
+	return warnings
+}
+
+// startedProvider is the outcome of starting one provider
+type startedProvider struct {
+	name     string
+	provider mcp.Provider
+	err      error
+}
+
+// warning describes a provider that could not be started
+func (s startedProvider) warning() string {
+	return fmt.Sprintf("%s is unavailable: %v. Run prodterm doctor for a fix.", s.name, s.err)
+}
+
+// startProviders starts all MCP providers without registering them, sending
+// their requests through transport when it is not nil. Failures are left for
+// the caller to report, wherever its user will see them.
+func startProviders(cfg config.Config, transport *cassette.Transport) []startedProvider {
+	// Initialize Gmail provider
+	var gmailProvider *gmail.Provider
+	var err error
+	switch {
+	case transport == nil:
+		gmailProvider, err = gmail.New(cfg.Gmail)
+	case transport.Mode == cassette.Replay:
+		// Replayed requests need no credentials
+		gmailProvider, err = gmail.NewWithHTTPClient(transport.Client())
+	default:
+		gmailProvider, err = gmail.NewWithTransport(cfg.Gmail, transport)
+	}
+	gmailStarted := startedProvider{name: "Gmail", err: err}
+	if err == nil {
+		gmailStarted.provider = gmailProvider
+		log.Println("Started Gmail provider")
+	}
+	
+	// Initialize Slack provider
+	var slackProvider *slack.Provider
+	switch {
+	case transport == nil:
+		slackProvider, err = slack.New(cfg.Slack)
+	case transport.Mode == cassette.Replay:
+		slackProvider, err = slack.NewWithToken(replaySlackToken, slackapi.OptionHTTPClient(transport.Client()))
+	default:
+		slackProvider, err = slack.New(cfg.Slack, slackapi.OptionHTTPClient(transport.Client()))
+	}
+	slackStarted := startedProvider{name: "Slack", err: err}
+	if err == nil {
+		slackStarted.provider = slackProvider
+		log.Println("Started Slack provider")
+	}
+	
+	return []startedProvider{gmailStarted, slackStarted}
 }
@@ -0,0 +1,100 @@
+package mcp
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// CachePolicy returns how long the results of a provider command may be
+// reused for; zero means they are always fetched afresh
+type CachePolicy func(provider string, command string) time.Duration
+
+// cachedResult is a provider result and when it stops being reused
+type cachedResult struct {
+	result    interface{}
+	expiresAt time.Time
+}
+
+// Provider results are kept in memory rather than on disk, as callers rely
+// on their exact Go types, which do not survive encoding. Results are shared
+// between callers, which must not modify them.
+var (
+	cachePolicy  CachePolicy
+	cacheEntries = make(map[string]cachedResult)
+	cacheMutex   sync.Mutex
+)
+
+// SetCachePolicy reuses the results of provider commands for as long as
+// policy allows. Only commands without side effects should be given a
+// lifetime. A nil policy turns caching off.
+func SetCachePolicy(policy CachePolicy) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cachePolicy = policy
+	cacheEntries = make(map[string]cachedResult)
+}
+
+// ClearCache forgets every cached provider result and returns how many there
+// were
+func ClearCache() int {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	n := len(cacheEntries)
+	cacheEntries = make(map[string]cachedResult)
+	return n
+}
+
+// cacheKey identifies a command and its parameters, returning how long its
+// result may be reused for, or false if it is not cached
+func cacheKey(provider string, command string, params map[string]interface{}) (string, time.Duration, bool) {
+	cacheMutex.Lock()
+	policy := cachePolicy
+	cacheMutex.Unlock()
+	if policy == nil {
+		return "", 0, false
+	}
+
+	ttl := policy(provider, command)
+	if ttl <= 0 {
+		return "", 0, false
+	}
+
+	// Maps are encoded with sorted keys, so equal parameters match
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return "", 0, false
+	}
+	return provider + "\x00" + command + "\x00" + string(encoded), ttl, true
+}
+
+// cached returns an unexpired result stored under key
+func cached(key string) (interface{}, bool) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	entry, ok := cacheEntries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(cacheEntries, key)
+		return nil, false
+	}
+	return entry.result, true
+}
+
+// storeResult keeps a result under key for ttl
+func storeResult(key string, result interface{}, ttl time.Duration) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	// Drop expired results so the cache cannot grow without bound
+	now := time.Now()
+	for k, entry := range cacheEntries {
+		if now.After(entry.expiresAt) {
+			delete(cacheEntries, k)
+		}
+	}
+	cacheEntries[key] = cachedResult{result: result, expiresAt: now.Add(ttl)}
+}
@@ -1,5 +1,7 @@
 package mcp
 
+import "context"
+
 // Provider defines the interface for a Model Context Protocol provider
 type Provider interface {
 	// Name returns the provider's name
@@ -8,8 +10,9 @@ type Provider interface {
 	// GetCapabilities returns the provider's capabilities
 	GetCapabilities() []Capability
 	
-	// Execute runs a command with the given parameters
-	Execute(command string, params map[string]interface{}) (interface{}, error)
+	// Execute runs a command with the given parameters, giving up when ctx
+	// is cancelled
+	Execute(ctx context.Context, command string, params map[string]interface{}) (interface{}, error)
 }
 
 // Capability represents a provider capability
@@ -17,4 +20,22 @@ type Capability struct {
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Commands    []string `json:"commands"`
+	
+	// CommandInfo optionally describes each command, keyed by command name.
+	// Described commands are offered to Claude as tools with precise inputs.
+	CommandInfo map[string]CommandInfo `json:"command_info,omitempty"`
+}
+
+// CommandInfo describes what a command does and the parameters it accepts
+type CommandInfo struct {
+	Description string      `json:"description"`
+	Parameters  []Parameter `json:"parameters,omitempty"`
+}
+
+// Parameter describes a single command parameter
+type Parameter struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // JSON Schema type, e.g. "string" or "integer"
+	Description string `json:"description"`
+	Required    bool   `json:"required,omitempty"`
 }
@@ -1,8 +1,23 @@
 package mcp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
+)
+
+// CommandTimeout bounds how long a single provider command may run
+const CommandTimeout = 30 * time.Second
+
+// Errors for commands that fail before reaching the service behind a
+// provider. Providers wrap them, so that callers can tell them from the
+// service's own failures with errors.Is.
+var (
+	ErrProviderNotFound = errors.New("provider not found")
+	ErrUnknownCommand   = errors.New("unknown command")
+	ErrInvalidParams    = errors.New("invalid parameters")
 )
 
 var (
@@ -17,6 +32,32 @@ func Register(provider Provider) {
 	registry[provider.Name()] = provider
 }
 
+// Reset removes every provider, and forgets the results cached from them, so
+// that another set can be registered, such as after switching profiles
+func Reset() {
+	mutex.Lock()
+	registry = make(map[string]Provider)
+	mutex.Unlock()
+	
+	ClearCache()
+}
+
+// Replace registers providers in place of every current one at once, and
+// forgets the results cached from the old ones, so that commands never find
+// the registry half way through a change
+func Replace(providers ...Provider) {
+	next := make(map[string]Provider, len(providers))
+	for _, provider := range providers {
+		next[provider.Name()] = provider
+	}
+	
+	mutex.Lock()
+	registry = next
+	mutex.Unlock()
+	
+	ClearCache()
+}
+
 // Get returns a provider by name
 func Get(name string) (Provider, error) {
 	mutex.RLock()
@@ -26,7 +67,7 @@ func Get(name string) (Provider, error) {
 		return provider, nil
 	}
 	
-	return nil, fmt.Errorf("provider not found: %s", name)
+	return nil, fmt.Errorf("%w: %s", ErrProviderNotFound, name)
 }
 
 // ListProviders returns a list of registered providers
@@ -42,12 +83,33 @@ func ListProviders() []string {
 	return providers
 }
 
-// ExecuteCommand executes a command on a provider
-func ExecuteCommand(provider string, command string, params map[string]interface{}) (interface{}, error) {
+// ExecuteCommand executes a command on a provider, cancelling it if it runs
+// longer than CommandTimeout or ctx is cancelled. A recent result is reused
+// when the cache policy allows it; see SetCachePolicy.
+func ExecuteCommand(ctx context.Context, provider string, command string, params map[string]interface{}) (interface{}, error) {
 	p, err := Get(provider)
 	if err != nil {
 		return nil, err
 	}
 	
-	return p.Execute(command, params)
+	key, ttl, cacheable := cacheKey(provider, command, params)
+	if cacheable {
+		if result, ok := cached(key); ok {
+			trace(ctx, Call{Provider: provider, Command: command, Params: params, Result: result})
+			return result, nil
+		}
+	}
+	
+	commandCtx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+	
+	result, err := p.Execute(commandCtx, command, params)
+	if err != nil {
+		return result, err
+	}
+	if cacheable {
+		storeResult(key, result, ttl)
+	}
+	trace(ctx, Call{Provider: provider, Command: command, Params: params, Result: result})
+	return result, nil
 }
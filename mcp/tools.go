@@ -0,0 +1,115 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"terminal-claude/models"
+)
+
+// toolSeparator joins provider and command names into a tool name
+const toolSeparator = "__"
+
+// maxToolResultLength bounds how much of a command result is sent back to Claude
+const maxToolResultLength = 50000
+
+// ToolName returns the name a provider command is offered to Claude under
+func ToolName(provider string, command string) string {
+	return provider + toolSeparator + command
+}
+
+// Tools describes the commands of every registered provider as Claude tools
+func Tools() []models.Tool {
+	providers := ListProviders()
+	sort.Strings(providers)
+
+	var tools []models.Tool
+	for _, name := range providers {
+		p, err := Get(name)
+		if err != nil {
+			continue
+		}
+
+		for _, capability := range p.GetCapabilities() {
+			for _, command := range capability.Commands {
+				tools = append(tools, newTool(name, capability, command))
+			}
+		}
+	}
+
+	return tools
+}
+
+// ExecuteTool runs the provider command behind a tool call and returns the
+// result encoded as JSON
+func ExecuteTool(ctx context.Context, name string, input json.RawMessage) (string, error) {
+	parts := strings.SplitN(name, toolSeparator, 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+
+	params := map[string]interface{}{}
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &params); err != nil {
+			return "", fmt.Errorf("invalid input for %s: %v", name, err)
+		}
+	}
+
+	result, err := ExecuteCommand(ctx, parts[0], parts[1], params)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode result of %s: %v", name, err)
+	}
+
+	text := string(data)
+	if len(text) > maxToolResultLength {
+		text = text[:maxToolResultLength] + "... (result truncated)"
+	}
+
+	return text, nil
+}
+
+// newTool builds the tool definition for a single provider command
+func newTool(provider string, capability Capability, command string) models.Tool {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	description := fmt.Sprintf("%s: %s command of the %s provider.", capability.Description, command, provider)
+	info, described := capability.CommandInfo[command]
+	if described {
+		description = fmt.Sprintf("%s (%s). %s", provider, capability.Description, info.Description)
+		for _, param := range info.Parameters {
+			properties[param.Name] = map[string]interface{}{
+				"type":        param.Type,
+				"description": param.Description,
+			}
+			if param.Required {
+				required = append(required, param.Name)
+			}
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	if !described {
+		// Without a description of the parameters let Claude pass anything
+		schema["additionalProperties"] = true
+	}
+
+	return models.Tool{
+		Name:        ToolName(provider, command),
+		Description: description,
+		InputSchema: schema,
+	}
+}
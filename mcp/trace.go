@@ -0,0 +1,38 @@
+package mcp
+
+import "context"
+
+// Call is a provider command that was run and the result it returned
+type Call struct {
+	Provider string                 `json:"provider"`
+	Command  string                 `json:"command"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	Result   interface{}            `json:"result"`
+}
+
+// CallFunc receives each provider command run under a traced context
+type CallFunc func(Call)
+
+// traceKey is the context key WithTrace stores its CallFunc under
+type traceKey struct{}
+
+// WithTrace returns a context under which every command ExecuteCommand runs
+// successfully, or answers from the cache, is passed to onCall, including
+// those Claude runs as tools. Any trace already on ctx still receives them.
+func WithTrace(ctx context.Context, onCall CallFunc) context.Context {
+	if outer, ok := ctx.Value(traceKey{}).(CallFunc); ok {
+		inner := onCall
+		onCall = func(call Call) {
+			inner(call)
+			outer(call)
+		}
+	}
+	return context.WithValue(ctx, traceKey{}, onCall)
+}
+
+// trace passes a call to the trace on ctx, if there is one
+func trace(ctx context.Context, call Call) {
+	if onCall, ok := ctx.Value(traceKey{}).(CallFunc); ok {
+		onCall(call)
+	}
+}
@@ -1,18 +1,70 @@
 package models
 
+import "encoding/json"
+
 // AnthropicResponse from Anthropic API
 type AnthropicResponse struct {
-	Content []struct {
-		Text string `json:"text"`
-		Type string `json:"type"`
-	} `json:"content"`
-	ID string `json:"id"`
+	Content    []MessageContent `json:"content"`
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	StopReason string           `json:"stop_reason"`
+	Usage      Usage            `json:"usage"`
+}
+
+// Usage reports the tokens consumed by a request
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
 // MessageContent represents a content item in a message
 type MessageContent struct {
 	Type string `json:"type"`
-	Text string `json:"text"`
+	Text string `json:"text,omitempty"`
+	
+	// Tool use fields, set on "tool_use" blocks from Claude
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	
+	// Tool result fields, set on "tool_result" blocks sent back to Claude
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+	
+	// Thinking fields, set on "thinking" blocks from Claude. Redacted
+	// thinking is returned encrypted in Data. Both must be sent back
+	// unchanged along with tool results.
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+	
+	// Source holds the data of "image" and "document" blocks
+	Source *ContentSource `json:"source,omitempty"`
+	Title  string         `json:"title,omitempty"` // optional, for documents
+	
+	// CacheControl marks the end of a prefix the API should cache
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// ContentSource is the data of an image or document block
+type ContentSource struct {
+	Type      string `json:"type"` // "base64"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// CacheControl asks the API to cache the request up to and including the
+// block it is attached to
+type CacheControl struct {
+	Type string `json:"type"`
+}
+
+// EphemeralCache returns the cache control for the API's short-lived cache
+func EphemeralCache() *CacheControl {
+	return &CacheControl{Type: "ephemeral"}
 }
 
 // Message represents a message in the conversation with structured content
@@ -23,10 +75,67 @@ type Message struct {
 
 // AnthropicRequest to Anthropic API
 type AnthropicRequest struct {
-	Model     string    `json:"model"`
-	Messages  []Message `json:"messages"`
-	MaxTokens int       `json:"max_tokens"`
-	System    string    `json:"system,omitempty"`
+	Model     string           `json:"model"`
+	Messages  []Message        `json:"messages"`
+	MaxTokens int              `json:"max_tokens"`
+	System    []MessageContent `json:"system,omitempty"`
+	Stream    bool             `json:"stream,omitempty"`
+	Tools     []Tool           `json:"tools,omitempty"`
+	
+	// ToolChoice, when set, controls whether and which tool Claude must use
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+	
+	// Thinking, when set, lets Claude reason before it answers
+	Thinking *ThinkingConfig `json:"thinking,omitempty"`
+}
+
+// ThinkingConfig enables extended thinking with a budget of tokens, which
+// counts towards max_tokens
+type ThinkingConfig struct {
+	Type         string `json:"type"` // "enabled"
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// ToolChoice tells Claude how to pick a tool: "auto", "any", or "tool" to
+// force the one named
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// Tool describes a tool Claude may ask to use
+type Tool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	InputSchema  map[string]interface{} `json:"input_schema"`
+	CacheControl *CacheControl          `json:"cache_control,omitempty"`
+}
+
+// StreamEvent is a single server-sent event from a streaming Anthropic response
+type StreamEvent struct {
+	Type         string             `json:"type"`
+	Index        int                `json:"index"`
+	Message      *AnthropicResponse `json:"message,omitempty"`
+	ContentBlock *MessageContent    `json:"content_block,omitempty"`
+	Delta        *StreamDelta       `json:"delta,omitempty"`
+	Usage        *Usage             `json:"usage,omitempty"`
+	Error        *StreamError       `json:"error,omitempty"`
+}
+
+// StreamDelta holds the incremental change carried by a stream event
+type StreamDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+	StopReason  string `json:"stop_reason,omitempty"`
+}
+
+// StreamError is reported when a stream fails part way through
+type StreamError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
 }
 
 // ChatMessage represents an older format message in the conversation
@@ -0,0 +1,164 @@
+package gmail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"terminal-claude/config"
+	"terminal-claude/doctor"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/gmail/v1"
+)
+
+// tokenInfoURL reports the scopes an access token grants
+const tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// readScopes are the scopes that let the provider read mail, any one of
+// which is enough
+var readScopes = []string{gmail.GmailReadonlyScope, gmail.GmailModifyScope, gmail.MailGoogleComScope}
+
+// Diagnose checks the credentials file, the stored token and the scopes it
+// grants, for prodterm doctor. Nothing is changed: an expired token is
+// refreshed in memory only.
+func Diagnose(ctx context.Context, cfg config.Gmail) []doctor.Check {
+	const credentialsCheck, tokenCheck, scopesCheck = "gmail credentials", "gmail token", "gmail scopes"
+	reauthorise := fmt.Sprintf("prodterm secrets rm %s, then start prodterm and follow the link to authorise Gmail again", cfg.TokenSecret)
+
+	// Gmail is optional, so it not being set up is only worth a warning
+	setUp := fmt.Sprintf("Create an OAuth client ID for a desktop app in Google Cloud Console and save its JSON as %s (see docs/gmail_setup.md)", cfg.Credentials)
+	data, err := os.ReadFile(cfg.Credentials)
+	if os.IsNotExist(err) {
+		return []doctor.Check{
+			doctor.Warning(credentialsCheck, "Gmail is not set up: "+cfg.Credentials+" does not exist", setUp),
+			doctor.Skipped(tokenCheck, "no credentials to use it with"),
+			doctor.Skipped(scopesCheck, "no credentials to use it with"),
+		}
+	}
+	if err != nil {
+		return []doctor.Check{
+			doctor.Failed(credentialsCheck, err.Error(), setUp),
+			doctor.Skipped(tokenCheck, "no credentials to use it with"),
+			doctor.Skipped(scopesCheck, "no credentials to use it with"),
+		}
+	}
+	oauthConfig, err := google.ConfigFromJSON(data, gmail.GmailReadonlyScope)
+	if err != nil {
+		return []doctor.Check{
+			doctor.Failed(credentialsCheck, fmt.Sprintf("%s is not an OAuth client file: %v", cfg.Credentials, err),
+				fmt.Sprintf("Download the JSON of an OAuth client ID for a desktop app from Google Cloud Console again and save it as %s", cfg.Credentials)),
+			doctor.Skipped(tokenCheck, "no credentials to use it with"),
+			doctor.Skipped(scopesCheck, "no credentials to use it with"),
+		}
+	}
+
+	// The client secret of a desktop app is not confidential, so loose
+	// permissions are only worth a warning
+	permissions := doctor.Permissions("gmail credentials permissions", cfg.Credentials, 0600)
+	if permissions.Status == doctor.Fail {
+		permissions.Status = doctor.Warn
+	}
+	checks := []doctor.Check{
+		doctor.Passed(credentialsCheck, fmt.Sprintf("%s (client %s)", cfg.Credentials, oauthConfig.ClientID)),
+		permissions,
+	}
+
+	stored, source, err := storedToken(cfg)
+	if err != nil {
+		return append(checks,
+			doctor.Failed(tokenCheck, err.Error(), reauthorise),
+			doctor.Skipped(scopesCheck, "no usable token"))
+	}
+	if stored == nil {
+		return append(checks,
+			doctor.Failed(tokenCheck, "Gmail has not been authorised yet", "Start prodterm and follow the link it prints to authorise Gmail"),
+			doctor.Skipped(scopesCheck, "no token"))
+	}
+
+	token, err := oauthConfig.TokenSource(ctx, stored).Token()
+	if err != nil {
+		return append(checks,
+			doctor.Failed(tokenCheck, fmt.Sprintf("the token in %s was rejected: %v", source, err), reauthorise),
+			doctor.Skipped(scopesCheck, "no usable token"))
+	}
+	if source == cfg.Token {
+		checks = append(checks, doctor.Warning(tokenCheck, "valid, but kept in plain text in "+source,
+			"Start prodterm once to move it into the secret store"))
+	} else {
+		checks = append(checks, doctor.Passed(tokenCheck, "valid, from "+source))
+	}
+
+	granted, err := tokenScopes(ctx, token.AccessToken)
+	if err != nil {
+		return append(checks, doctor.Failed(scopesCheck, err.Error(), "Check your network connection and try again"))
+	}
+	for _, scope := range granted {
+		for _, wanted := range readScopes {
+			if scope == wanted {
+				return append(checks, doctor.Passed(scopesCheck, scope))
+			}
+		}
+	}
+	return append(checks, doctor.Failed(scopesCheck,
+		fmt.Sprintf("the token does not allow reading mail (granted: %s)", strings.Join(granted, " ")), reauthorise))
+}
+
+// storedToken finds the token without moving it into the secret store,
+// returning where it was found, or a nil token when there is none
+func storedToken(cfg config.Gmail) (*oauth2.Token, string, error) {
+	data, ok, err := cfg.Secrets.Get(cfg.TokenSecret)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read token from the secret store: %v", err)
+	}
+	if ok {
+		token := &oauth2.Token{}
+		if err := json.Unmarshal([]byte(data), token); err != nil {
+			return nil, "", fmt.Errorf("invalid token in the secret store: %v", err)
+		}
+		return token, "the secret store", nil
+	}
+
+	token, err := getTokenFromFile(cfg.Token)
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid token in %s: %v", cfg.Token, err)
+	}
+	return token, cfg.Token, nil
+}
+
+// tokenScopes asks Google which scopes an access token grants
+func tokenScopes(ctx context.Context, accessToken string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", tokenInfoURL+"?access_token="+url.QueryEscape(accessToken), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up the token's scopes: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up the token's scopes: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to look up the token's scopes: %s", strings.TrimSpace(string(body)))
+	}
+
+	var info struct {
+		Scope string `json:"scope"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("unable to look up the token's scopes: %v", err)
+	}
+	return strings.Fields(info.Scope), nil
+}
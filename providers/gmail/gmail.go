@@ -7,9 +7,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
+	"terminal-claude/config"
 	"terminal-claude/mcp"
 
 	"golang.org/x/oauth2"
@@ -23,21 +24,21 @@ type Provider struct {
 	service *gmail.Service
 }
 
-// New creates a new Gmail provider
-func New() (*Provider, error) {
+// New creates a new Gmail provider from its section of the configuration
+func New(cfg config.Gmail) (*Provider, error) {
+	return NewWithTransport(cfg, nil)
+}
+
+// NewWithTransport creates a Gmail provider whose requests, including those
+// refreshing its token, are sent through transport. A nil transport uses
+// the default.
+func NewWithTransport(cfg config.Gmail, transport http.RoundTripper) (*Provider, error) {
 	ctx := context.Background()
-	
-	// Get credentials from environment variable or file
-	credentialsPath := os.Getenv("GMAIL_CREDENTIALS")
-	if credentialsPath == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("unable to get home directory: %v", err)
-		}
-		credentialsPath = filepath.Join(homeDir, ".config", "terminal-claude", "gmail_credentials.json")
+	if transport != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
 	}
-
-	b, err := ioutil.ReadFile(credentialsPath)
+	
+	b, err := ioutil.ReadFile(cfg.Credentials)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read credentials file: %v", err)
 	}
@@ -49,13 +50,19 @@ func New() (*Provider, error) {
 	}
 
 	// Get token from file or generate new one
-	token, err := getToken(config)
+	token, err := getToken(config, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get token: %v", err)
 	}
 
+	return NewWithHTTPClient(oauth2.NewClient(ctx, config.TokenSource(ctx, token)))
+}
+
+// NewWithHTTPClient creates a Gmail provider that sends its requests through
+// httpClient, which is responsible for authenticating them
+func NewWithHTTPClient(httpClient *http.Client) (*Provider, error) {
 	// Create the Gmail service
-	srv, err := gmail.NewService(ctx, option.WithTokenSource(config.TokenSource(ctx, token)))
+	srv, err := gmail.NewService(context.Background(), option.WithHTTPClient(httpClient))
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Gmail service: %v", err)
 	}
@@ -77,43 +84,60 @@ func (p *Provider) GetCapabilities() []mcp.Capability {
 			Name:        "email",
 			Description: "Access and manipulate email",
 			Commands:    []string{"list_unread", "get_email", "summarize_unread"},
+			CommandInfo: map[string]mcp.CommandInfo{
+				"list_unread": {
+					Description: "List the 10 most recent unread emails with their id, sender, recipient, subject and date.",
+				},
+				"get_email": {
+					Description: "Get a single email by id, including its full plain text body.",
+					Parameters: []mcp.Parameter{
+						{Name: "id", Type: "string", Description: "The email id, as returned by list_unread or summarize_unread", Required: true},
+					},
+				},
+				"summarize_unread": {
+					Description: "Get the most recent unread emails with their sender, subject, date and a short snippet of each.",
+					Parameters: []mcp.Parameter{
+						{Name: "count", Type: "integer", Description: "Maximum number of emails to return (default 10)"},
+					},
+				},
+			},
 		},
 	}
 }
 
 // Execute runs a command with the given parameters
-func (p *Provider) Execute(command string, params map[string]interface{}) (interface{}, error) {
+func (p *Provider) Execute(ctx context.Context, command string, params map[string]interface{}) (interface{}, error) {
 	switch command {
 	case "list_unread":
-		return p.listUnreadEmails()
+		return p.listUnreadEmails(ctx)
 	case "get_email":
 		id, ok := params["id"].(string)
 		if !ok {
-			return nil, fmt.Errorf("email id parameter required")
+			return nil, fmt.Errorf("%w: email id parameter required", mcp.ErrInvalidParams)
 		}
-		return p.getEmail(id)
+		return p.getEmail(ctx, id)
 	case "summarize_unread":
 		count := 10 // Default count
 		if c, ok := params["count"].(float64); ok {
 			count = int(c)
 		}
-		return p.summarizeUnreadEmails(count)
+		return p.summarizeUnreadEmails(ctx, count)
 	default:
-		return nil, fmt.Errorf("unknown command: %s", command)
+		return nil, fmt.Errorf("%w: %s", mcp.ErrUnknownCommand, command)
 	}
 }
 
 // listUnreadEmails lists unread emails
-func (p *Provider) listUnreadEmails() ([]map[string]interface{}, error) {
+func (p *Provider) listUnreadEmails(ctx context.Context) ([]map[string]interface{}, error) {
 	user := "me"
-	r, err := p.service.Users.Messages.List(user).Q("is:unread").MaxResults(10).Do()
+	r, err := p.service.Users.Messages.List(user).Q("is:unread").MaxResults(10).Context(ctx).Do()
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve messages: %v", err)
 	}
 
 	var messages []map[string]interface{}
 	for _, m := range r.Messages {
-		msg, err := p.service.Users.Messages.Get(user, m.Id).Format("metadata").Do()
+		msg, err := p.service.Users.Messages.Get(user, m.Id).Format("metadata").Context(ctx).Do()
 		if err != nil {
 			continue
 		}
@@ -137,9 +161,9 @@ func (p *Provider) listUnreadEmails() ([]map[string]interface{}, error) {
 }
 
 // getEmail gets a specific email by ID
-func (p *Provider) getEmail(id string) (map[string]interface{}, error) {
+func (p *Provider) getEmail(ctx context.Context, id string) (map[string]interface{}, error) {
 	user := "me"
-	msg, err := p.service.Users.Messages.Get(user, id).Format("full").Do()
+	msg, err := p.service.Users.Messages.Get(user, id).Format("full").Context(ctx).Do()
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve message: %v", err)
 	}
@@ -197,21 +221,16 @@ func (p *Provider) getEmail(id string) (map[string]interface{}, error) {
 }
 
 // summarizeUnreadEmails gets a summary of unread emails
-func (p *Provider) summarizeUnreadEmails(count int) (map[string]interface{}, error) {
-	fmt.Println("DEBUG - Gmail provider: Fetching unread emails")
-	
+func (p *Provider) summarizeUnreadEmails(ctx context.Context, count int) (map[string]interface{}, error) {
 	user := "me"
-	r, err := p.service.Users.Messages.List(user).Q("is:unread").MaxResults(int64(count)).Do()
+	r, err := p.service.Users.Messages.List(user).Q("is:unread").MaxResults(int64(count)).Context(ctx).Do()
 	if err != nil {
-		fmt.Printf("DEBUG - Gmail error: %v\n", err)
 		return nil, fmt.Errorf("unable to retrieve messages: %v", err)
 	}
-	
-	fmt.Printf("DEBUG - Found %d unread messages\n", len(r.Messages))
 
 	var emails []map[string]interface{}
 	for _, m := range r.Messages {
-		msg, err := p.service.Users.Messages.Get(user, m.Id).Format("metadata").Do()
+		msg, err := p.service.Users.Messages.Get(user, m.Id).Format("metadata").Context(ctx).Do()
 		if err != nil {
 			continue
 		}
@@ -238,9 +257,35 @@ func (p *Provider) summarizeUnreadEmails(count int) (map[string]interface{}, err
 	}, nil
 }
 
-// getTokenFromFile retrieves a token from a local file
-func getTokenFromFile() (*oauth2.Token, error) {
-	tokenPath := getTokenPath()
+// loadToken retrieves the token from the secret store. A token still kept in
+// the old plain text file is moved into the store.
+func loadToken(cfg config.Gmail) (*oauth2.Token, bool, error) {
+	data, ok, err := cfg.Secrets.Get(cfg.TokenSecret)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to read token from the secret store: %v", err)
+	}
+	if ok {
+		token := &oauth2.Token{}
+		if err := json.Unmarshal([]byte(data), token); err != nil {
+			return nil, false, fmt.Errorf("invalid token in the secret store: %v", err)
+		}
+		return token, true, nil
+	}
+	
+	token, err := getTokenFromFile(cfg.Token)
+	if err != nil {
+		return nil, false, nil
+	}
+	if err := saveToken(cfg, token); err != nil {
+		log.Printf("Warning: unable to move the Gmail token into the secret store, leaving it in %s: %v", cfg.Token, err)
+	} else if err := os.Remove(cfg.Token); err == nil {
+		log.Printf("Moved the Gmail token from %s into the secret store", cfg.Token)
+	}
+	return token, true, nil
+}
+
+// getTokenFromFile retrieves a token from the old plain text token file
+func getTokenFromFile(tokenPath string) (*oauth2.Token, error) {
 	f, err := os.Open(tokenPath)
 	if err != nil {
 		return nil, err
@@ -251,36 +296,37 @@ func getTokenFromFile() (*oauth2.Token, error) {
 	return token, err
 }
 
-// saveToken saves a token to a file
-func saveToken(token *oauth2.Token) error {
-	tokenPath := getTokenPath()
-	
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(tokenPath)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return err
+// saveToken saves a token, including its refresh token, to the secret store
+func saveToken(cfg config.Gmail, token *oauth2.Token) error {
+	if cfg.Secrets == nil {
+		return fmt.Errorf("no secret store configured")
 	}
-	
-	f, err := os.OpenFile(tokenPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	data, err := json.Marshal(token)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	return json.NewEncoder(f).Encode(token)
+	return cfg.Secrets.Set(cfg.TokenSecret, string(data))
 }
 
 // getToken gets an OAuth token
-func getToken(config *oauth2.Config) (*oauth2.Token, error) {
-	// Try to read token from file
-	token, err := getTokenFromFile()
-	if err == nil {
+func getToken(config *oauth2.Config, cfg config.Gmail) (*oauth2.Token, error) {
+	// Try to read token from the secret store
+	token, ok, err := loadToken(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
 		return token, nil
 	}
 
 	// If no token found, get one from user
+	prompt := cfg.Prompt
+	if prompt == nil {
+		prompt = os.Stderr
+	}
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser: \n%v\n", authURL)
-	fmt.Println("Enter the authorization code:")
+	fmt.Fprintf(prompt, "Go to the following link in your browser: \n%v\n", authURL)
+	fmt.Fprintln(prompt, "Enter the authorization code:")
 
 	var authCode string
 	if _, err := fmt.Scan(&authCode); err != nil {
@@ -292,22 +338,9 @@ func getToken(config *oauth2.Config) (*oauth2.Token, error) {
 		return nil, fmt.Errorf("unable to retrieve token from web: %v", err)
 	}
 	
-	if err := saveToken(token); err != nil {
+	if err := saveToken(cfg, token); err != nil {
 		log.Printf("Warning: unable to save token: %v", err)
 	}
 	
 	return token, nil
 }
-
-// getTokenPath returns the path to the token file
-func getTokenPath() string {
-	tokenPath := os.Getenv("GMAIL_TOKEN")
-	if tokenPath == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			log.Fatalf("Unable to get home directory: %v", err)
-		}
-		tokenPath = filepath.Join(homeDir, ".config", "terminal-claude", "gmail_token.json")
-	}
-	return tokenPath
-}
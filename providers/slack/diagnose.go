@@ -0,0 +1,78 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"terminal-claude/config"
+	"terminal-claude/doctor"
+
+	"github.com/slack-go/slack"
+)
+
+// Diagnose checks that a Slack token is configured and that Slack accepts
+// it, for prodterm doctor. A token still in the old plain text file is not
+// moved.
+func Diagnose(ctx context.Context, cfg config.Slack, options ...slack.Option) []doctor.Check {
+	const tokenCheck, authCheck = "slack token", "slack auth"
+	replace := fmt.Sprintf("Create a new token for your Slack app (see docs/slack_setup.md) and run prodterm secrets set %s", cfg.TokenSecret)
+
+	token, source, err := storedToken(cfg)
+	if err != nil {
+		return []doctor.Check{
+			doctor.Failed(tokenCheck, err.Error(), "Check the passphrase of the secret store, or set PRODTERM_PASSPHRASE"),
+			doctor.Skipped(authCheck, "no token"),
+		}
+	}
+	// Slack is optional, so it not being set up is only worth a warning
+	if token == "" {
+		return []doctor.Check{
+			doctor.Warning(tokenCheck, "Slack is not set up: no token is configured", replace),
+			doctor.Skipped(authCheck, "no token"),
+		}
+	}
+
+	var checks []doctor.Check
+	switch {
+	case !strings.HasPrefix(token, "xoxb-") && !strings.HasPrefix(token, "xoxp-"):
+		checks = append(checks, doctor.Warning(tokenCheck,
+			fmt.Sprintf("the token from %s does not look like a bot (xoxb-) or user (xoxp-) token", source), replace))
+	case source == cfg.TokenPath:
+		checks = append(checks, doctor.Warning(tokenCheck, "kept in plain text in "+source,
+			"Start prodterm once to move it into the secret store"))
+	default:
+		checks = append(checks, doctor.Passed(tokenCheck, "from "+source))
+	}
+
+	auth, err := slack.New(token, options...).AuthTestContext(ctx)
+	if err != nil {
+		return append(checks, doctor.Failed(authCheck, fmt.Sprintf("Slack rejected the token: %v", err), replace))
+	}
+	return append(checks, doctor.Passed(authCheck, fmt.Sprintf("authenticated as %s in %s", auth.User, auth.Team)))
+}
+
+// storedToken finds the token without moving it into the secret store,
+// returning where it was found, or an empty token when there is none
+func storedToken(cfg config.Slack) (string, string, error) {
+	if cfg.Token != "" {
+		return cfg.Token, "SLACK_TOKEN or the config file", nil
+	}
+
+	token, ok, err := cfg.Secrets.Get(cfg.TokenSecret)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to read token from the secret store: %v", err)
+	}
+	if ok {
+		return token, "the secret store", nil
+	}
+
+	data, err := os.ReadFile(cfg.TokenPath)
+	if os.IsNotExist(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("unable to read token file: %v", err)
+	}
+	return strings.TrimSpace(string(data)), cfg.TokenPath, nil
+}
@@ -1,11 +1,12 @@
 package slack
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
+	"terminal-claude/config"
 	"terminal-claude/mcp"
 	"time"
 
@@ -17,19 +18,25 @@ type Provider struct {
 	client *slack.Client
 }
 
-// New creates a new Slack provider
-func New() (*Provider, error) {
-	// Get token from environment variable or file
-	token, err := getSlackToken()
+// New creates a new Slack provider from its section of the configuration,
+// passing options such as slack.OptionHTTPClient on to the Slack client
+func New(cfg config.Slack, options ...slack.Option) (*Provider, error) {
+	// Get token from the configuration or its file
+	token, err := getSlackToken(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get Slack token: %v", err)
 	}
 
+	return NewWithToken(token, options...)
+}
+
+// NewWithToken creates a Slack provider that authenticates with token
+func NewWithToken(token string, options ...slack.Option) (*Provider, error) {
 	// Create the Slack client
-	client := slack.New(token)
+	client := slack.New(token, options...)
 
 	// Test the connection - but make this optional
-	_, err = client.AuthTest()
+	_, err := client.AuthTest()
 	if err != nil {
 		log.Printf("Warning: Slack authentication not successful, but continuing anyway: %v", err)
 		// We'll continue even with authentication errors
@@ -53,35 +60,55 @@ func (p *Provider) GetCapabilities() []mcp.Capability {
 			Name:        "messages",
 			Description: "Access and summarize Slack messages",
 			Commands:    []string{"list_channels", "recent_messages", "summarize_channel"},
+			CommandInfo: map[string]mcp.CommandInfo{
+				"list_channels": {
+					Description: "List the Slack channels in the workspace with their id, name, topic and member count.",
+				},
+				"recent_messages": {
+					Description: "Get the most recent messages in a Slack channel, newest first, with author and time.",
+					Parameters: []mcp.Parameter{
+						{Name: "channel_id", Type: "string", Description: "The channel id, as returned by list_channels", Required: true},
+						{Name: "count", Type: "integer", Description: "Maximum number of messages to return (default 10)"},
+					},
+				},
+				"summarize_channel": {
+					Description: "Get the recent messages in a Slack channel looked up by id or by name, newest first.",
+					Parameters: []mcp.Parameter{
+						{Name: "channel_id", Type: "string", Description: "The channel id; takes precedence over channel"},
+						{Name: "channel", Type: "string", Description: "The channel name, with or without a leading #"},
+						{Name: "count", Type: "integer", Description: "Maximum number of messages to return (default 10)"},
+					},
+				},
+			},
 		},
 	}
 }
 
 // Execute runs a command with the given parameters
-func (p *Provider) Execute(command string, params map[string]interface{}) (interface{}, error) {
+func (p *Provider) Execute(ctx context.Context, command string, params map[string]interface{}) (interface{}, error) {
 	switch command {
 	case "list_channels":
-		return p.listChannels()
+		return p.listChannels(ctx)
 	case "recent_messages":
 		channelID, ok := params["channel_id"].(string)
 		if !ok {
-			return nil, fmt.Errorf("channel_id parameter required")
+			return nil, fmt.Errorf("%w: channel_id parameter required", mcp.ErrInvalidParams)
 		}
 		count := 10 // Default count
 		if c, ok := params["count"].(float64); ok {
 			count = int(c)
 		}
-		return p.recentMessages(channelID, count)
+		return p.recentMessages(ctx, channelID, count)
 	case "summarize_channel":
 		channelID, ok := params["channel_id"].(string)
 		if !ok {
 			// Try to get channel by name if ID is not provided
 			channelName, ok := params["channel"].(string)
 			if !ok {
-				return nil, fmt.Errorf("either channel_id or channel parameter required")
+				return nil, fmt.Errorf("%w: either channel_id or channel parameter required", mcp.ErrInvalidParams)
 			}
 			var err error
-			channelID, err = p.getChannelIDByName(channelName)
+			channelID, err = p.getChannelIDByName(ctx, channelName)
 			if err != nil {
 				return nil, err
 			}
@@ -90,15 +117,15 @@ func (p *Provider) Execute(command string, params map[string]interface{}) (inter
 		if c, ok := params["count"].(float64); ok {
 			count = int(c)
 		}
-		return p.summarizeChannel(channelID, count)
+		return p.summarizeChannel(ctx, channelID, count)
 	default:
-		return nil, fmt.Errorf("unknown command: %s", command)
+		return nil, fmt.Errorf("%w: %s", mcp.ErrUnknownCommand, command)
 	}
 }
 
 // listChannels lists available Slack channels
-func (p *Provider) listChannels() (map[string]interface{}, error) {
-	channels, cursor, err := p.client.GetConversations(&slack.GetConversationsParameters{
+func (p *Provider) listChannels(ctx context.Context) (map[string]interface{}, error) {
+	channels, cursor, err := p.client.GetConversationsContext(ctx, &slack.GetConversationsParameters{
 		Types: []string{"public_channel", "private_channel"},
 	})
 	if err != nil {
@@ -123,9 +150,9 @@ func (p *Provider) listChannels() (map[string]interface{}, error) {
 }
 
 // recentMessages gets recent messages from a channel
-func (p *Provider) recentMessages(channelID string, count int) (map[string]interface{}, error) {
+func (p *Provider) recentMessages(ctx context.Context, channelID string, count int) (map[string]interface{}, error) {
 	// Get messages from the channel
-	history, err := p.client.GetConversationHistory(&slack.GetConversationHistoryParameters{
+	history, err := p.client.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
 		ChannelID: channelID,
 		Limit:     count,
 	})
@@ -138,7 +165,7 @@ func (p *Provider) recentMessages(channelID string, count int) (map[string]inter
 		// Get user info if available
 		var username string
 		if msg.User != "" {
-			user, err := p.client.GetUserInfo(msg.User)
+			user, err := p.client.GetUserInfoContext(ctx, msg.User)
 			if err == nil {
 				username = user.RealName
 				if username == "" {
@@ -164,7 +191,7 @@ func (p *Provider) recentMessages(channelID string, count int) (map[string]inter
 	}
 
 	// Get channel info
-	channel, err := p.client.GetConversationInfo(&slack.GetConversationInfoInput{
+	channel, err := p.client.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{
 		ChannelID: channelID,
 	})
 	if err != nil {
@@ -182,14 +209,14 @@ func (p *Provider) recentMessages(channelID string, count int) (map[string]inter
 }
 
 // summarizeChannel gets a summary of a channel
-func (p *Provider) summarizeChannel(channelID string, count int) (map[string]interface{}, error) {
-	result, err := p.recentMessages(channelID, count)
+func (p *Provider) summarizeChannel(ctx context.Context, channelID string, count int) (map[string]interface{}, error) {
+	result, err := p.recentMessages(ctx, channelID, count)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get channel info
-	channel, err := p.client.GetConversationInfo(&slack.GetConversationInfoInput{
+	channel, err := p.client.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{
 		ChannelID: channelID,
 	})
 	
@@ -208,11 +235,11 @@ func (p *Provider) summarizeChannel(channelID string, count int) (map[string]int
 }
 
 // getChannelIDByName gets a channel ID from a channel name
-func (p *Provider) getChannelIDByName(channelName string) (string, error) {
+func (p *Provider) getChannelIDByName(ctx context.Context, channelName string) (string, error) {
 	// Remove the # prefix if present
 	channelName = strings.TrimPrefix(channelName, "#")
 	
-	channels, _, err := p.client.GetConversations(&slack.GetConversationsParameters{
+	channels, _, err := p.client.GetConversationsContext(ctx, &slack.GetConversationsParameters{
 		Types: []string{"public_channel", "private_channel"},
 	})
 	if err != nil {
@@ -225,38 +252,41 @@ func (p *Provider) getChannelIDByName(channelName string) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("channel not found: %s", channelName)
+	return "", fmt.Errorf("%w: channel not found: %s", mcp.ErrInvalidParams, channelName)
 }
 
-// getSlackToken gets the Slack API token
-func getSlackToken() (string, error) {
-	// Try to get from environment
-	token := os.Getenv("SLACK_TOKEN")
-	if token != "" {
+// getSlackToken gets the Slack API token from the configuration or the
+// secret store. A token still kept in the old plain text file is moved into
+// the store.
+func getSlackToken(cfg config.Slack) (string, error) {
+	if cfg.Token != "" {
+		return cfg.Token, nil
+	}
+
+	token, ok, err := cfg.Secrets.Get(cfg.TokenSecret)
+	if err != nil {
+		return "", fmt.Errorf("unable to read token from the secret store: %v", err)
+	}
+	if ok {
 		return token, nil
 	}
 
 	// Try to get from file
-	tokenPath := getTokenPath()
-	data, err := os.ReadFile(tokenPath)
+	data, err := os.ReadFile(cfg.TokenPath)
 	if err != nil {
-		return "", fmt.Errorf("unable to read token file: %v", err)
+		return "", fmt.Errorf("no token in the secret store (prodterm secrets set %s) and unable to read token file: %v", cfg.TokenSecret, err)
 	}
+	token = strings.TrimSpace(string(data))
 
-	return strings.TrimSpace(string(data)), nil
-}
-
-// getTokenPath returns the path to the token file
-func getTokenPath() string {
-	tokenPath := os.Getenv("SLACK_TOKEN_PATH")
-	if tokenPath == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			log.Fatalf("Unable to get home directory: %v", err)
-		}
-		tokenPath = filepath.Join(homeDir, ".config", "terminal-claude", "slack_token.txt")
+	if cfg.Secrets == nil {
+		return token, nil
 	}
-	return tokenPath
+	if err := cfg.Secrets.Set(cfg.TokenSecret, token); err != nil {
+		log.Printf("Warning: unable to move the Slack token into the secret store, leaving it in %s: %v", cfg.TokenPath, err)
+	} else if err := os.Remove(cfg.TokenPath); err == nil {
+		log.Printf("Moved the Slack token from %s into the secret store", cfg.TokenPath)
+	}
+	return token, nil
 }
 
 // parseSlackTimestamp converts a Slack timestamp to a time.Time
@@ -305,14 +335,3 @@ func formatTimeAgo(t time.Time) string {
 		return t.Format("Jan 2")
 	}
 }
-
-// init registers the provider
-func init() {
-	provider, err := New()
-	if err != nil {
-		log.Printf("Warning: Unable to initialize Slack provider: %v", err)
-		return
-	}
-	
-	mcp.Register(provider)
-}
\ No newline at end of file
@@ -0,0 +1,54 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// PassphraseEnv names the environment variable that can hold the passphrase,
+// for running without a terminal
+const PassphraseEnv = "PRODTERM_PASSPHRASE"
+
+// Prompt is a PassphraseFunc that takes the passphrase from
+// PRODTERM_PASSPHRASE, or else asks for it on the terminal, twice when
+// creating a vault
+func Prompt(create bool) (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("the secret store is locked: set %s to unlock it without a terminal", PassphraseEnv)
+	}
+
+	if !create {
+		return readHidden(fd, "Passphrase for the prodterm secret store: ")
+	}
+
+	passphrase, err := readHidden(fd, "Choose a passphrase for the new prodterm secret store: ")
+	if err != nil {
+		return "", err
+	}
+	confirm, err := readHidden(fd, "Enter it again: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirm {
+		return "", fmt.Errorf("the passphrases did not match")
+	}
+	return passphrase, nil
+}
+
+// readHidden asks for a line on the terminal without echoing it
+func readHidden(fd int, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("unable to read passphrase: %v", err)
+	}
+	return string(line), nil
+}
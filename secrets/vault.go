@@ -0,0 +1,350 @@
+// Package secrets keeps API keys and tokens in a vault file encrypted with a
+// passphrase, rather than in plain text files. The vault is only unlocked
+// when a secret is first needed, so the passphrase is never asked for by
+// those who do not use it.
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// FileName is the name of the vault file in the config directory
+const FileName = "secrets.vault"
+
+// Names of the secrets prodterm looks for
+const (
+	AnthropicAPIKey = "anthropic_api_key"
+	SlackToken      = "slack_token"
+	GmailToken      = "gmail_token"
+)
+
+// ErrWrongPassphrase is returned when the vault cannot be decrypted
+var ErrWrongPassphrase = errors.New("wrong passphrase, or the secret store is damaged")
+
+// Key derivation parameters for new vaults; see scrypt.Key
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keySize = 32
+)
+
+// vaultVersion identifies the layout of the vault file and is authenticated
+// along with the secrets
+const vaultVersion = "prodterm-vault-v1"
+
+// vaultFile is the layout of the vault on disk
+type vaultFile struct {
+	Version    string `json:"version"`
+	Salt       []byte `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// PassphraseFunc supplies the passphrase for a vault. create is set when the
+// vault does not exist yet, so the passphrase should be confirmed.
+type PassphraseFunc func(create bool) (string, error)
+
+// Vault is a file of named secrets encrypted with a passphrase
+type Vault struct {
+	path       string
+	passphrase PassphraseFunc
+	mutex      sync.Mutex
+
+	// Set once the vault has been unlocked
+	unlocked bool
+	header   vaultFile
+	key      []byte
+	secrets  map[string]string
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// New creates a vault kept at path, asking passphrase for the passphrase
+// when it is first unlocked. Nothing is read until then.
+func New(path string, passphrase PassphraseFunc) *Vault {
+	return &Vault{path: path, passphrase: passphrase}
+}
+
+// Path returns the vault file
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// Exists reports whether the vault file has been created
+func (v *Vault) Exists() bool {
+	_, err := os.Stat(v.path)
+	return err == nil
+}
+
+// Locked reports whether the vault exists but has not been unlocked yet, so
+// that reading it would ask for the passphrase
+func (v *Vault) Locked() bool {
+	if v == nil || !v.Exists() {
+		return false
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return !v.unlocked
+}
+
+// Refresh reads the vault again after another process, such as prodterm
+// secrets, has changed it. A vault that has not been unlocked yet is read
+// afresh when it is first used anyway. The passphrase is not asked for
+// again, so a vault re-created with another passphrase cannot be refreshed.
+func (v *Vault) Refresh() error {
+	if v == nil {
+		return nil
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if !v.unlocked {
+		return nil
+	}
+
+	data, err := os.ReadFile(v.path)
+	if os.IsNotExist(err) {
+		v.secrets = map[string]string{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read secret store: %v", err)
+	}
+
+	file, err := v.parse(data)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(file.Salt, v.header.Salt) || file.N != v.header.N || file.R != v.header.R || file.P != v.header.P {
+		return fmt.Errorf("the secret store was re-created with another passphrase; restart prodterm to unlock it")
+	}
+	secrets, err := decrypt(file, v.key)
+	if err != nil {
+		return err
+	}
+	v.secrets = secrets
+	return nil
+}
+
+// Get returns a secret, reporting whether it was found. Looking up a secret
+// before the vault exists finds nothing, without asking for a passphrase.
+func (v *Vault) Get(name string) (string, bool, error) {
+	if v == nil || !v.Exists() {
+		return "", false, nil
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if err := v.unlock(); err != nil {
+		return "", false, err
+	}
+	value, ok := v.secrets[name]
+	return value, ok, nil
+}
+
+// Set stores a secret, creating the vault if need be
+func (v *Vault) Set(name string, value string) error {
+	if v == nil {
+		return fmt.Errorf("no secret store configured")
+	}
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q: use lower case letters, digits, '_', '.' and '-'", name)
+	}
+	if value == "" {
+		return fmt.Errorf("the value of %s is empty", name)
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if err := v.unlock(); err != nil {
+		return err
+	}
+	v.secrets[name] = value
+	return v.save()
+}
+
+// Remove deletes a secret, reporting whether there was one to delete
+func (v *Vault) Remove(name string) (bool, error) {
+	if v == nil || !v.Exists() {
+		return false, nil
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if err := v.unlock(); err != nil {
+		return false, err
+	}
+	if _, ok := v.secrets[name]; !ok {
+		return false, nil
+	}
+	delete(v.secrets, name)
+	return true, v.save()
+}
+
+// Names returns the names of the stored secrets in order
+func (v *Vault) Names() ([]string, error) {
+	if v == nil || !v.Exists() {
+		return nil, nil
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if err := v.unlock(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(v.secrets))
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// unlock reads and decrypts the vault, or prepares a new one if it does not
+// exist. The caller holds the mutex.
+func (v *Vault) unlock() error {
+	if v.unlocked {
+		return nil
+	}
+
+	data, err := os.ReadFile(v.path)
+	create := os.IsNotExist(err)
+	if err != nil && !create {
+		return fmt.Errorf("unable to read secret store: %v", err)
+	}
+
+	if v.passphrase == nil {
+		return fmt.Errorf("no passphrase available to unlock the secret store")
+	}
+	passphrase, err := v.passphrase(create)
+	if err != nil {
+		return err
+	}
+	if passphrase == "" {
+		return fmt.Errorf("the passphrase cannot be empty")
+	}
+
+	if create {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		v.header = vaultFile{Version: vaultVersion, Salt: salt, N: scryptN, R: scryptR, P: scryptP}
+		if v.key, err = scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keySize); err != nil {
+			return err
+		}
+		v.secrets = map[string]string{}
+		v.unlocked = true
+		return nil
+	}
+
+	file, err := v.parse(data)
+	if err != nil {
+		return err
+	}
+	key, err := scrypt.Key([]byte(passphrase), file.Salt, file.N, file.R, file.P, keySize)
+	if err != nil {
+		return fmt.Errorf("invalid secret store: %v", err)
+	}
+	secrets, err := decrypt(file, key)
+	if err != nil {
+		return err
+	}
+
+	v.header = file
+	v.key = key
+	v.secrets = secrets
+	v.unlocked = true
+	return nil
+}
+
+// parse reads the layout of the vault file
+func (v *Vault) parse(data []byte) (vaultFile, error) {
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != vaultVersion {
+		return vaultFile{}, fmt.Errorf("%s is not a prodterm secret store", v.path)
+	}
+	return file, nil
+}
+
+// decrypt returns the secrets in a vault file, which key must have encrypted
+func decrypt(file vaultFile, key []byte) (map[string]string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, []byte(vaultVersion))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid secret store: %v", err)
+	}
+	if secrets == nil {
+		secrets = map[string]string{}
+	}
+	return secrets, nil
+}
+
+// save encrypts the secrets with a fresh nonce and writes the vault. The
+// caller holds the mutex.
+func (v *Vault) save() error {
+	plaintext, err := json.Marshal(v.secrets)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(v.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	file := v.header
+	file.Nonce = nonce
+	file.Ciphertext = aead.Seal(nil, nonce, plaintext, []byte(vaultVersion))
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash cannot leave a partial vault
+	tmpPath := v.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, v.path)
+}
+
+// newAEAD returns AES-256-GCM with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
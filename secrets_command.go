@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"terminal-claude/config"
+
+	"golang.org/x/term"
+)
+
+const secretsUsage = `Usage:
+  prodterm secrets list                list the names of stored secrets
+  prodterm secrets set <name>          store a secret, read from the terminal or stdin
+  prodterm secrets get <name>          print a secret
+  prodterm secrets rm <name>           delete a secret
+
+Secrets prodterm looks for: anthropic_api_key, slack_token, gmail_token.
+Set PRODTERM_PASSPHRASE to unlock the store without a terminal.`
+
+// runSecrets runs the secrets command and returns the exit code
+func runSecrets(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return 2
+	}
+
+	vault := config.OpenSecrets()
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		names, err := vault.Names()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case args[0] == "set" && len(args) == 3:
+		// A value on the command line would end up in the shell history and
+		// be visible to other users in the process list
+		fmt.Fprintf(os.Stderr, "Error: the value is not taken as an argument, so that it stays out of the shell history and process list.\n"+
+			"Run prodterm secrets set %s and enter it when asked, or pipe it to stdin.\n", args[1])
+		return 2
+	case args[0] == "set" && len(args) == 2:
+		value, err := readSecret(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if err := vault.Set(args[1], value); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Stored %s in %s\n", args[1], vault.Path())
+	case args[0] == "get" && len(args) == 2:
+		value, ok, err := vault.Get(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "No secret named %s\n", args[1])
+			return 1
+		}
+		fmt.Println(value)
+	case args[0] == "rm" && len(args) == 2:
+		removed, err := vault.Remove(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if !removed {
+			fmt.Fprintf(os.Stderr, "No secret named %s\n", args[1])
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Removed %s\n", args[1])
+	default:
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return 2
+	}
+	return 0
+}
+
+// readSecret reads a secret's value without echoing it on a terminal, or
+// from the first line of stdin otherwise, so that it stays out of the shell
+// history
+func readSecret(name string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "Value for %s: ", name)
+		value, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("unable to read value: %v", err)
+		}
+		return strings.TrimSpace(string(value)), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("unable to read value: %v", err)
+	}
+	return strings.TrimSpace(line), nil
+}
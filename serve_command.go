@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"terminal-claude/config"
+	"terminal-claude/handlers"
+	"terminal-claude/server"
+)
+
+const serveUsage = `Usage: prodterm serve [--addr host:port] [flags]
+
+Serves prodterm over a local HTTP/JSON API, so that editor plugins and
+dashboards can share one running instance and its providers:
+
+  POST /v1/commands                                 run a command
+  GET  /v1/providers                                list providers, their commands and any that failed to start
+  POST /v1/providers/{provider}/commands/{command}  run a provider command
+
+Commands run one at a time and continue one conversation shared by every
+client, as in the UI; send "/new" to start afresh.
+
+Every request needs an "Authorization: Bearer <token>" header. The token is
+taken from $PRODTERM_SERVE_TOKEN, or else generated into serve_token in the
+config directory (the profile's directory with --profile). Stops gracefully
+on Ctrl+C or SIGTERM.`
+
+// serveTokenFile is where a generated bearer token is kept, under the
+// profile's data directory
+const serveTokenFile = "serve_token"
+
+// runServe runs the serve command and returns the exit code
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	var flags config.Flags
+	flags.Register(fs)
+	addr := fs.String("addr", server.DefaultAddr, "loopback address to listen on")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, serveUsage)
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := server.CheckLocal(*addr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.LoadWithFlags(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	transport, err := cassetteTransport(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading cassette: %v\n", err)
+		return 1
+	}
+	if cfg.DataDir == "" && os.Getenv(server.TokenEnv) == "" {
+		fmt.Fprintf(os.Stderr, "Error: there is no config directory to keep a token in; set %s\n", server.TokenEnv)
+		return 1
+	}
+	token, tokenSource, err := server.LoadToken(filepath.Join(cfg.DataDir, serveTokenFile))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Clients find the same warnings under GET /v1/providers
+	warnings := initializeProviders(cfg, transport)
+	for _, warning := range warnings {
+		log.Printf("Warning: %s", warning)
+	}
+	setCachePolicy(cfg)
+
+	var httpClient *http.Client
+	if transport != nil {
+		httpClient = transport.Client()
+	}
+	handler := handlers.NewHandlerWithHTTPClient(cfg, httpClient)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	srv := &http.Server{
+		Handler:           server.New(handler, token, warnings...).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Stop taking requests on Ctrl+C or SIGTERM, giving those running time
+	// to finish before they are cut off
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), server.ShutdownTimeout)
+		defer cancel()
+		err := srv.Shutdown(shutdownCtx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = srv.Close()
+		}
+		stopped <- err
+	}()
+
+	log.Printf("Serving on http://%s with the bearer token from %s", listener.Addr(), tokenSource)
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := <-stopped; err != nil {
+		fmt.Fprintf(os.Stderr, "Error shutting down: %v\n", err)
+		return 1
+	}
+	return 0
+}
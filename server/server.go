@@ -0,0 +1,258 @@
+// Package server exposes a command handler and the registered providers over
+// a local HTTP/JSON API, so that editor plugins and dashboards can share one
+// running prodterm and its authorised providers
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"terminal-claude/handlers"
+	"terminal-claude/mcp"
+)
+
+// DefaultAddr is where the server listens unless told otherwise
+const DefaultAddr = "127.0.0.1:7878"
+
+// ShutdownTimeout bounds how long requests still running at shutdown are
+// given to finish
+const ShutdownTimeout = 30 * time.Second
+
+// maxRequestSize bounds a request body, which may carry input to go with a
+// command
+const maxRequestSize = 2 * 1024 * 1024
+
+// Server answers API requests with a command handler. Commands run one at a
+// time, continuing a single conversation as they would in the UI, whichever
+// client sends them; the usage each reports is its own. Input sent with a
+// command goes only with that command. Provider commands called directly
+// run alongside them.
+type Server struct {
+	handler  *handlers.Handler
+	token    string
+	warnings []string
+
+	// mutex serialises commands, which share the handler's conversation
+	mutex sync.Mutex
+}
+
+// New creates a server that runs commands with handler for requests bearing
+// token. Warnings about providers that could not be started are reported to
+// clients along with the providers that were.
+func New(handler *handlers.Handler, token string, warnings ...string) *Server {
+	return &Server{handler: handler, token: token, warnings: warnings}
+}
+
+// Handler returns the API's routes, all of which require the bearer token
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/commands", s.handleCommand)
+	mux.HandleFunc("GET /v1/providers", s.handleProviders)
+	mux.HandleFunc("POST /v1/providers/{provider}/commands/{command}", s.handleProviderCommand)
+	return s.authenticate(mux)
+}
+
+// CheckLocal refuses addresses other clients on the network could reach,
+// as the API acts with the user's credentials
+func CheckLocal(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("%s is not a loopback address; use 127.0.0.1, ::1 or localhost", addr)
+}
+
+// authenticate rejects requests without the bearer token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="prodterm"`)
+			writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// commandRequest is the body of POST /v1/commands
+type commandRequest struct {
+	// Command is anything that could be typed at the prompt
+	Command string `json:"command"`
+
+	// Input is text to go along with the command as context, as piped to
+	// prodterm ask
+	Input string `json:"input,omitempty"`
+
+	// Stream asks for events as the command runs, as does an Accept header
+	// of text/event-stream
+	Stream bool `json:"stream,omitempty"`
+}
+
+// handleCommand runs a command, answering with its result as JSON or, when
+// asked to stream, with its events as server-sent events
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
+	var req commandRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	req.Command = strings.TrimSpace(req.Command)
+	if req.Command == "" {
+		writeError(w, http.StatusBadRequest, errors.New("command is required"))
+		return
+	}
+	stream := req.Stream || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The input belongs to this command alone, so it must not be left queued
+	// for the next client's if the command fails or sends no prompt
+	if req.Input != "" {
+		s.handler.AttachText("input", req.Input)
+	}
+	defer s.handler.ClearAttachments()
+	if stream {
+		s.streamCommand(w, r, req.Command)
+		return
+	}
+
+	result, err := s.handler.ProcessCommand(r.Context(), req.Command)
+	if err != nil {
+		writeError(w, commandStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// streamCommand runs a command, sending each of its events as it happens.
+// The request's context is cancelled, and so the command, if the client
+// goes away.
+func (s *Server) streamCommand(w http.ResponseWriter, r *http.Request, command string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var mutex sync.Mutex
+	s.handler.ProcessCommandEvents(r.Context(), command, func(event handlers.Event) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			data, _ = json.Marshal(handlers.Event{Type: handlers.EventError, Error: err.Error()})
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		flusher.Flush()
+	})
+}
+
+// providerInfo describes a registered provider for GET /v1/providers
+type providerInfo struct {
+	Name         string           `json:"name"`
+	Capabilities []mcp.Capability `json:"capabilities"`
+}
+
+// handleProviders lists the registered providers and their commands, and
+// says why any others could not be started
+func (s *Server) handleProviders(w http.ResponseWriter, r *http.Request) {
+	names := mcp.ListProviders()
+	sort.Strings(names)
+
+	providers := make([]providerInfo, 0, len(names))
+	for _, name := range names {
+		provider, err := mcp.Get(name)
+		if err != nil {
+			// Removed since it was listed, by a profile switch
+			continue
+		}
+		providers = append(providers, providerInfo{Name: name, Capabilities: provider.GetCapabilities()})
+	}
+	warnings := s.warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"providers": providers, "warnings": warnings})
+}
+
+// handleProviderCommand runs a provider command directly, with the request
+// body as its parameters, answering with the provider's result
+func (s *Server) handleProviderCommand(w http.ResponseWriter, r *http.Request) {
+	name, command := r.PathValue("provider"), r.PathValue("command")
+	if _, err := mcp.Get(name); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	// An empty body means no parameters
+	params := map[string]interface{}{}
+	if err := readJSON(w, r, &params); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := mcp.ExecuteCommand(r.Context(), name, command, params)
+	if err != nil {
+		writeError(w, commandStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"result": result})
+}
+
+// readJSON decodes a request body, refusing unknown fields and bodies over
+// maxRequestSize
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// writeJSON sends v as the response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// commandStatus returns the status for a command that failed: 404 for a
+// provider or command that does not exist, 400 for parameters the provider
+// refused, and 502 when the service behind a provider or Claude failed
+func commandStatus(err error) int {
+	switch {
+	case errors.Is(err, mcp.ErrProviderNotFound), errors.Is(err, mcp.ErrUnknownCommand):
+		return http.StatusNotFound
+	case errors.Is(err, mcp.ErrInvalidParams):
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// writeError sends an error as {"error": "..."}
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
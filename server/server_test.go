@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"terminal-claude/api/apitest"
+	"terminal-claude/handlers"
+	"terminal-claude/mcp"
+)
+
+// post sends a request to the server and returns the response status
+func post(t *testing.T, ts *httptest.Server, token string, path string, body string) int {
+	t.Helper()
+	req, err := http.NewRequest("POST", ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestCommandInputDoesNotLeak(t *testing.T) {
+	fake := apitest.NewFake(
+		apitest.Reply{Err: context.DeadlineExceeded},
+		apitest.Reply{Text: "Nothing was attached."},
+	)
+	ts := httptest.NewServer(New(handlers.NewHandlerWithLLM(fake), "secret").Handler())
+	defer ts.Close()
+
+	// The first client's command fails, leaving its input unsent
+	if status := post(t, ts, "secret", "/v1/commands", `{"command": "review this diff", "input": "private diff"}`); status != http.StatusBadGateway {
+		t.Fatalf("first command status %d, want %d", status, http.StatusBadGateway)
+	}
+	if status := post(t, ts, "secret", "/v1/commands", `{"command": "what is attached?"}`); status != http.StatusOK {
+		t.Fatalf("second command status %d", status)
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(requests))
+	}
+	if len(requests[0].Attachments) != 1 || !strings.Contains(requests[0].Attachments[0].Text, "private diff") {
+		t.Errorf("first command was sent without its input: %+v", requests[0].Attachments)
+	}
+	if len(requests[1].Attachments) != 0 {
+		t.Errorf("second command was sent the first one's input: %+v", requests[1].Attachments)
+	}
+}
+
+func TestRequiresToken(t *testing.T) {
+	ts := httptest.NewServer(New(handlers.NewHandlerWithLLM(apitest.NewFake()), "secret").Handler())
+	defer ts.Close()
+
+	if status := post(t, ts, "wrong", "/v1/commands", `{"command": "hello"}`); status != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestProvidersReportsWarnings(t *testing.T) {
+	warning := "Slack is unavailable: no token. Run prodterm doctor for a fix."
+	ts := httptest.NewServer(New(handlers.NewHandlerWithLLM(apitest.NewFake()), "secret", warning).Handler())
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/v1/providers", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Providers []providerInfo `json:"providers"`
+		Warnings  []string       `json:"warnings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Warnings) != 1 || body.Warnings[0] != warning {
+		t.Errorf("warnings = %q", body.Warnings)
+	}
+}
+
+// fakeProvider fails in each of the ways a provider command can
+type fakeProvider struct{}
+
+func (fakeProvider) Name() string { return "Fake" }
+
+func (fakeProvider) GetCapabilities() []mcp.Capability { return nil }
+
+func (fakeProvider) Execute(ctx context.Context, command string, params map[string]interface{}) (interface{}, error) {
+	switch command {
+	case "get":
+		if _, ok := params["id"].(string); !ok {
+			return nil, fmt.Errorf("%w: id parameter required", mcp.ErrInvalidParams)
+		}
+		return "found", nil
+	case "broken":
+		return nil, errors.New("service unavailable")
+	default:
+		return nil, fmt.Errorf("%w: %s", mcp.ErrUnknownCommand, command)
+	}
+}
+
+func TestCommandErrorStatus(t *testing.T) {
+	mcp.Replace(fakeProvider{})
+	t.Cleanup(mcp.Reset)
+	ts := httptest.NewServer(New(handlers.NewHandlerWithLLM(apitest.NewFake()), "secret").Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"succeeds", "/v1/providers/Fake/commands/get", `{"id": "1"}`, http.StatusOK},
+		{"unknown provider", "/v1/providers/Missing/commands/get", `{}`, http.StatusNotFound},
+		{"unknown command", "/v1/providers/Fake/commands/delete", `{}`, http.StatusNotFound},
+		{"missing parameter", "/v1/providers/Fake/commands/get", `{}`, http.StatusBadRequest},
+		{"wrong parameter type", "/v1/providers/Fake/commands/get", `{"id": 1}`, http.StatusBadRequest},
+		{"service failure", "/v1/providers/Fake/commands/broken", `{}`, http.StatusBadGateway},
+		{"provider needed by a command", "/v1/commands", `{"command": "list slack channels"}`, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := post(t, ts, "secret", test.path, test.body); status != test.want {
+				t.Errorf("status %d, want %d", status, test.want)
+			}
+		})
+	}
+}
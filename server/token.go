@@ -0,0 +1,52 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TokenEnv names the environment variable that sets the bearer token
+const TokenEnv = "PRODTERM_SERVE_TOKEN"
+
+// minTokenLength keeps a token set by hand from being easily guessed
+const minTokenLength = 16
+
+// LoadToken returns the bearer token set by TokenEnv, or else the one saved
+// at path, which is created the first time. Only its owner can read the
+// file, so clients run by the same user can pick the token up from it. The
+// token's source is returned for the startup message.
+func LoadToken(path string) (string, string, error) {
+	if token := os.Getenv(TokenEnv); token != "" {
+		if len(token) < minTokenLength {
+			return "", "", fmt.Errorf("%s must be at least %d characters long", TokenEnv, minTokenLength)
+		}
+		return token, TokenEnv, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, path, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", "", fmt.Errorf("unable to read token file: %v", err)
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", fmt.Errorf("unable to generate token: %v", err)
+	}
+	token := hex.EncodeToString(random)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", "", fmt.Errorf("unable to create token directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", "", fmt.Errorf("unable to save token: %v", err)
+	}
+	return token, path, nil
+}
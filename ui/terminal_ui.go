@@ -1,10 +1,15 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"terminal-claude/api"
+	"terminal-claude/batch"
 	"terminal-claude/config"
 	"terminal-claude/handlers"
+	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -34,8 +39,16 @@ var (
 		Foreground(lipgloss.Color("#FF5F5F")).
 		Bold(true)
 
+	noticeStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color("#FFAF00")).
+		Italic(true)
+
 	helpStyle = lipgloss.NewStyle().
 		Foreground(lipgloss.Color("#5F5F5F"))
+
+	thinkingStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color("#8A8A8A")).
+		Italic(true)
         
     spinnerStyle = lipgloss.NewStyle().
         Foreground(lipgloss.Color("205"))
@@ -43,6 +56,32 @@ var (
 
 type errMsg error
 
+// batchPollInterval is how often unfinished batch jobs are checked on
+const batchPollInterval = 30 * time.Second
+
+// batchTickMsg is time to check on batch jobs
+type batchTickMsg struct{}
+
+// configPollInterval is how often the config file and secret store are
+// checked for changes
+const configPollInterval = 2 * time.Second
+
+// configTickMsg is time to check the config file and secret store
+type configTickMsg struct{}
+
+// configReloadedMsg describes the outcome of checking the config file and
+// secret store; notice is empty when neither had changed
+type configReloadedMsg struct {
+	notice   string
+	warnings []string
+}
+
+// batchPolledMsg reports the batch jobs that finished since the last check
+type batchPolledMsg struct {
+	finished []batch.Job
+	err      error
+}
+
 // Model represents the UI state
 type Model struct {
 	viewport    viewport.Model
@@ -51,21 +90,50 @@ type Model struct {
 	handler     *handlers.Handler
 	history     []string
 	response    string
+	streaming   string
+	cancel      context.CancelFunc
+	cancelled   bool
 	err         error
 	loading     bool
+	
+	// thoughts holds Claude's reasoning, keyed by its entry in history, so
+	// it can be expanded and collapsed again with Ctrl+T
+	thoughts     map[int]string
+	showThinking bool
+	
+	// batchErr is why the last check on batch jobs failed, if it did
+	batchErr error
+	
+	// reloading is set while changes to the configuration are applied,
+	// during which no request is started
+	reloading bool
+	
 	windowWidth int
     windowHeight int
 }
 
 // InitialModel creates and initializes the UI model
 func InitialModel(cfg config.Config) Model {
+	return InitialModelWithHandler(handlers.NewHandler(cfg))
+}
+
+// InitialModelWithHandler creates the initial UI model around a handler,
+// showing warnings, such as about providers that could not be started,
+// under the welcome message
+func InitialModelWithHandler(h *handlers.Handler, warnings ...string) Model {
 	ti := textinput.New()
 	ti.Placeholder = "Type your request..."
 	ti.Focus()
 	ti.Width = 80
 	
+	// The window size is not known yet, so wrap to the default width
+	history := []string{welcomeMessage()}
+	for _, warning := range warnings {
+		history = append(history, noticeStyle.Render(wrapText("["+warning+"]", 76)))
+	}
+	
 	vp := viewport.New(80, 20)
-	vp.SetContent(welcomeMessage())
+	vp.SetContent(strings.Join(history, "\n"))
 	
 	s := spinner.New()
 	s.Spinner = spinner.Dot
@@ -75,8 +143,9 @@ func InitialModel(cfg config.Config) Model {
 		textInput: ti,
 		viewport:  vp,
 		spinner:   s,
-		handler:   handlers.NewHandler(cfg),
-		history:   []string{welcomeMessage()},
+		handler:   h,
+		history:   history,
+		thoughts:  map[int]string{},
         windowWidth: 80,
         windowHeight: 24,
 	}
@@ -141,31 +210,146 @@ func welcomeMessage() string {
 		"- what's on this webpage? bbc.co.uk\n" +
 		"- list slack channels\n" +
 		"- summarise slack channel #general\n" +
-		"- tell me about golang\n"
+		"- tell me about golang\n" +
+		"- /new (start a new conversation)\n" +
+		"- /usage (token usage and cost by handler)\n" +
+		"- /attach ~/screenshot.png (attach an image or PDF to your next prompt)\n" +
+		"- /persona terse-sre (switch answering style; /persona lists them)\n" +
+		"- /batch emails (summarise every unread email in bulk; /batch lists jobs)\n" +
+		"- /cache clear (forget cached answers, when the response cache is on)\n" +
+		"- /profile switch work (switch to another profile; /profile lists them)\n"
 }
 
 // Init initializes the UI
 func (m Model) Init() tea.Cmd {
-	return tea.Batch(textinput.Blink, m.spinner.Tick)
+	return tea.Batch(textinput.Blink, m.spinner.Tick, m.pollBatches(), tickBatches(), tickConfig())
+}
+
+// tickConfig schedules the next check on the config file and secret store
+func tickConfig() tea.Cmd {
+	return tea.Tick(configPollInterval, func(time.Time) tea.Msg {
+		return configTickMsg{}
+	})
+}
+
+// reloadConfig applies any changes to the config file and secret store in
+// the background
+func (m Model) reloadConfig() tea.Cmd {
+	handler := m.handler
+	return func() tea.Msg {
+		notice, warnings := handler.ReloadIfChanged()
+		return configReloadedMsg{notice: notice, warnings: warnings}
+	}
+}
+
+// tickBatches schedules the next check on batch jobs
+func tickBatches() tea.Cmd {
+	return tea.Tick(batchPollInterval, func(time.Time) tea.Msg {
+		return batchTickMsg{}
+	})
+}
+
+// pollBatches checks on unfinished batch jobs in the background
+func (m Model) pollBatches() tea.Cmd {
+	if m.handler.PendingBatches() == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), batchPollInterval)
+		defer cancel()
+		finished, err := m.handler.PollBatches(ctx)
+		return batchPolledMsg{finished: finished, err: err}
+	}
 }
 
 // Update handles UI events
 type responseMsg struct {
-	response string
+	result *handlers.Result
 }
 
-// sendRequest sends the request to the handler
-func (m Model) sendRequest(input string) tea.Cmd {
+// streamChunkMsg carries a piece of a response that is still being generated,
+// along with the channel the rest of the request's events arrive on
+type streamChunkMsg struct {
+	delta  string
+	events <-chan tea.Msg
+}
+
+// sendRequest sends the request to the handler, which gives up when ctx is cancelled
+func (m Model) sendRequest(ctx context.Context, input string) tea.Cmd {
 	// Make a local copy of the input to ensure it doesn't change
 	commandToProcess := input
 	
-	return func() tea.Msg {
-		response, err := m.handler.ProcessCommand(commandToProcess)
+	// The handler runs in the background and reports streamed text, then the
+	// final response or error, on this channel. Once ctx is cancelled nothing
+	// may be reading it any more, so every send gives up then and the
+	// channel is closed instead, for waitForEvent to report.
+	events := make(chan tea.Msg)
+	send := func(msg tea.Msg) {
+		select {
+		case events <- msg:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(events)
+		result, err := m.handler.ProcessCommandStream(ctx, commandToProcess, func(delta string) {
+			send(streamChunkMsg{delta: delta, events: events})
+		})
 		if err != nil {
-			return errMsg(err)
+			send(errMsg(err))
+			return
+		}
+		send(responseMsg{result: result})
+	}()
+	
+	return waitForEvent(events)
+}
+
+// waitForEvent waits for the next event from an in-flight request. A closed
+// channel means the request was cancelled before its outcome was sent.
+func waitForEvent(events <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return errMsg(context.Canceled)
+		}
+		return msg
+	}
+}
+
+// releaseRequest frees the context of the request that just finished
+func (m *Model) releaseRequest() {
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+}
+
+// renderThinking renders a reasoning section, expanded or as a one-line
+// summary depending on whether reasoning is being shown
+func (m Model) renderThinking(thinking string) string {
+	if !m.showThinking {
+		return thinkingStyle.Render(fmt.Sprintf("▸ Thought for %d words (Ctrl+T to expand)", len(strings.Fields(thinking))))
+	}
+	
+	maxWidth := m.windowWidth - 4 // Account for margins
+	if maxWidth <= 0 {
+		maxWidth = 76 // Default width
+	}
+	return thinkingStyle.Render("▾ Thinking (Ctrl+T to collapse)\n" + wrapText(thinking, maxWidth))
+}
+
+// viewportContent joins the history with any response still being streamed
+func (m Model) viewportContent() string {
+	content := strings.Join(m.history, "\n")
+	if m.streaming != "" {
+		maxWidth := m.windowWidth - 4 // Account for margins
+		if maxWidth <= 0 {
+			maxWidth = 76 // Default width
 		}
-		return responseMsg{response: response}
+		content += "\n" + responseStyle.Render(wrapText(m.streaming, maxWidth))
 	}
+	return content
 }
 
 // Update handles UI events and updates the model
@@ -180,8 +364,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.Type {
 		case tea.KeyCtrlC:
+			if m.cancel != nil {
+				m.cancel()
+			}
 			return m, tea.Quit
+		case tea.KeyEsc:
+			// Abandon the in-flight request; its error arrives as usual
+			if m.loading && m.cancel != nil && !m.cancelled {
+				m.cancel()
+				m.cancelled = true
+			}
+			return m, nil
 		case tea.KeyEnter:
+			if m.loading || m.reloading {
+				return m, nil
+			}
 			if m.textInput.Value() == "" {
 				return m, nil
 			}
@@ -194,8 +391,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			
 			m.history = append(m.history, "> "+userInput)
 			m.loading = true
+			m.cancelled = false
 			m.textInput.Reset()
 			
+			ctx, cancel := context.WithCancel(context.Background())
+			m.cancel = cancel
+			
 			// Create a clean spinner
 			s := spinner.New()
 			s.Spinner = spinner.Dot
@@ -209,36 +410,132 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Scroll to bottom
 			m.viewport.GotoBottom()
 			
-			return m, tea.Batch(m.sendRequest(userInput), m.spinner.Tick)
+			return m, tea.Batch(m.sendRequest(ctx, userInput), m.spinner.Tick)
+			
+		case tea.KeyCtrlT:
+			// Expand or collapse every reasoning section
+			m.showThinking = !m.showThinking
+			for i, thinking := range m.thoughts {
+				m.history[i] = m.renderThinking(thinking)
+			}
+			m.viewport.SetContent(m.viewportContent())
+			return m, nil
 			
 		case tea.KeyCtrlL:
 			m.history = []string{welcomeMessage()}
+			m.thoughts = map[int]string{}
 			m.viewport.SetContent(strings.Join(m.history, "\n"))
 			return m, nil
 		}
 
+	case batchTickMsg:
+		return m, tea.Batch(m.pollBatches(), tickBatches())
+		
+	case configTickMsg:
+		// Changes wait until the request in flight has finished
+		if m.loading {
+			return m, tickConfig()
+		}
+		m.reloading = true
+		return m, m.reloadConfig()
+		
+	case configReloadedMsg:
+		m.reloading = false
+		if msg.notice == "" {
+			return m, tickConfig()
+		}
+		maxWidth := m.windowWidth - 4 // Account for margins
+		if maxWidth <= 0 {
+			maxWidth = 76 // Default width
+		}
+		m.history = append(m.history, noticeStyle.Render(wrapText("["+msg.notice+"]", maxWidth)))
+		for _, warning := range msg.warnings {
+			m.history = append(m.history, noticeStyle.Render(wrapText("["+warning+"]", maxWidth)))
+		}
+		m.viewport.SetContent(m.viewportContent())
+		m.viewport.GotoBottom()
+		return m, tickConfig()
+		
+	case batchPolledMsg:
+		m.batchErr = msg.err
+		if len(msg.finished) == 0 {
+			return m, nil
+		}
+		maxWidth := m.windowWidth - 4 // Account for margins
+		if maxWidth <= 0 {
+			maxWidth = 76 // Default width
+		}
+		for _, job := range msg.finished {
+			notice := fmt.Sprintf("[Batch ready: %s, %s. Type /batch results %s to read it.]", job.Name, job.Progress(), job.ID)
+			m.history = append(m.history, noticeStyle.Render(wrapText(notice, maxWidth)))
+		}
+		m.viewport.SetContent(m.viewportContent())
+		m.viewport.GotoBottom()
+		return m, nil
+		
+	case streamChunkMsg:
+		m.streaming += msg.delta
+		m.viewport.SetContent(m.viewportContent())
+		m.viewport.GotoBottom()
+		return m, waitForEvent(msg.events)
+
 	case responseMsg:
 		m.loading = false
+		m.streaming = ""
+		m.releaseRequest()
 		// Completely reinitialize the spinner
 		s := spinner.New()
 		s.Spinner = spinner.Dot
 		s.Style = spinnerStyle
 		m.spinner = s
 		
+		// Carry on with another profile's handler after switching to it
+		if msg.result.Handler != nil {
+			m.handler = msg.result.Handler
+		}
+		
 		// Make sure the response is wrapped to fit the width
 		maxWidth := m.windowWidth - 4 // Account for margins
 		if maxWidth <= 0 {
 			maxWidth = 76 // Default width
 		}
 		
-		wrappedResponse := wrapText(msg.response, maxWidth)
+		// Claude's reasoning goes before its answer, collapsed unless asked for
+		if msg.result.Thinking != "" {
+			m.thoughts[len(m.history)] = msg.result.Thinking
+			m.history = append(m.history, m.renderThinking(msg.result.Thinking))
+		}
+		
+		wrappedResponse := wrapText(msg.result.Text, maxWidth)
 		m.history = append(m.history, responseStyle.Render(wrappedResponse))
+		
+		// Say when the answer was reused rather than asked for afresh
+		if msg.result.Cached {
+			m.history = append(m.history, thinkingStyle.Render("(cached answer · /cache clear to ask afresh)"))
+		}
+		
+		// Action items and questions picked out of a digest
+		if triage := msg.result.Triage(); triage != "" {
+			m.history = append(m.history, responseStyle.Render(wrapText(triage, maxWidth)))
+		}
+		for _, warning := range msg.result.Warnings {
+			m.history = append(m.history, noticeStyle.Render(wrapText("["+warning+"]", maxWidth)))
+		}
+		
+		// Make it obvious when the answer is incomplete
+		if msg.result.Truncated {
+			notice := "[Response truncated: it reached the token limit. Raise CLAUDE_MAX_TOKENS or CLAUDE_MAX_CONTINUATIONS, or ask me to continue.]"
+			m.history = append(m.history, noticeStyle.Render(wrapText(notice, maxWidth)))
+		}
 		m.viewport.SetContent(strings.Join(m.history, "\n"))
 		m.viewport.GotoBottom()
 		return m, nil
 
 	case errMsg:
 		m.loading = false
+		partial := m.streaming
+		m.streaming = ""
+		m.releaseRequest()
 		// Completely reinitialize the spinner
 		s := spinner.New()
 		s.Spinner = spinner.Dot
@@ -254,6 +551,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		
 		errText := fmt.Sprintf("Error: %v", msg)
+		var apiErr *api.APIError
+		if errors.As(msg, &apiErr) {
+			errText = "Error: " + apiErr.Description()
+		}
+		
+		// A cancelled request keeps whatever had already been streamed
+		if m.cancelled {
+			if partial != "" {
+				m.history = append(m.history, responseStyle.Render(wrapText(partial, maxWidth)))
+			}
+			errText = "Request cancelled."
+		}
 		wrappedError := wrapText(errText, maxWidth)
 		m.history = append(m.history, errorStyle.Render(wrappedError))
 		m.viewport.SetContent(strings.Join(m.history, "\n"))
@@ -276,7 +585,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		
 		// Update content
 		if m.viewport.Height >= 0 {
-			m.viewport.SetContent(strings.Join(m.history, "\n"))
+			m.viewport.SetContent(m.viewportContent())
 			m.viewport.GotoBottom()
 		}
         
@@ -313,7 +622,13 @@ func (m Model) View() string {
 	// Input field or spinner
 	if m.loading {
 		// Display a single spinner without duplication
-		footerContent = m.spinner.View() + " Processing..."
+		if m.cancelled {
+			footerContent = m.spinner.View() + " Cancelling..."
+		} else if m.streaming != "" {
+			footerContent = m.spinner.View() + " Receiving... " + helpStyle.Render("(Esc to cancel)")
+		} else {
+			footerContent = m.spinner.View() + " Processing... " + helpStyle.Render("(Esc to cancel)")
+		}
 	} else {
 		// Box-style prompt with width constraint
 		boxStyle := promptStyle.Copy().Width(availWidth - 2) // Apply width constraint to the box
@@ -321,7 +636,23 @@ func (m Model) View() string {
 	}
 	
 	// Help text
-	helpText := helpStyle.Render("Ctrl+C to quit, Ctrl+L to clear")
+	help := "Ctrl+C to quit, Ctrl+L to clear · session: " + m.handler.UsageSummary()
+	if pending := m.handler.PendingBatches(); pending > 0 {
+		help += fmt.Sprintf(" · batches: %d pending", pending)
+		if m.batchErr != nil {
+			help += " (last check failed)"
+		}
+	}
+	if profile := m.handler.Profile(); profile != config.DefaultProfile {
+		help += " · profile: " + profile
+	}
+	if persona := m.handler.Persona(); persona != "" {
+		help += " · persona: " + persona
+	}
+	if attached := m.handler.PendingAttachments(); len(attached) > 0 {
+		help += " · attached: " + strings.Join(attached, ", ")
+	}
+	helpText := helpStyle.Render(help)
 	
 	// Ensure the terminal width constraint is respected by all content
     maxWidth := m.windowWidth
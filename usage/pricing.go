@@ -0,0 +1,61 @@
+package usage
+
+import (
+	"strings"
+	"terminal-claude/models"
+)
+
+// Prices are the list prices of a model in US dollars per million tokens
+type Prices struct {
+	Input      float64
+	Output     float64
+	CacheWrite float64
+	CacheRead  float64
+}
+
+// priceTable maps model name prefixes to their prices. The longest matching
+// prefix wins, so dated model versions share the price of their family.
+var priceTable = map[string]Prices{
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25, CacheWrite: 0.30, CacheRead: 0.03},
+	"claude-3-sonnet":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-opus":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-haiku-4":    {Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.10},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-opus-4":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+	"claude-opus-4-5":   {Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.50},
+}
+
+// PriceFor returns the prices of a model, or false if it is not in the table
+func PriceFor(model string) (Prices, bool) {
+	var best string
+	for prefix := range priceTable {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return Prices{}, false
+	}
+	return priceTable[best], true
+}
+
+// BatchRate is the fraction of the usual price charged for requests made
+// through the Message Batches API
+const BatchRate = 0.5
+
+// Cost returns the price in US dollars of the tokens used by a request to a
+// model, or false if the model's price is unknown
+func Cost(model string, u models.Usage) (float64, bool) {
+	prices, ok := PriceFor(model)
+	if !ok {
+		return 0, false
+	}
+	cost := float64(u.InputTokens)*prices.Input +
+		float64(u.OutputTokens)*prices.Output +
+		float64(u.CacheCreationInputTokens)*prices.CacheWrite +
+		float64(u.CacheReadInputTokens)*prices.CacheRead
+	return cost / 1000000, true
+}
@@ -0,0 +1,303 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"terminal-claude/models"
+	"time"
+)
+
+// Totals accumulate token usage and cost over a number of requests
+type Totals struct {
+	Requests            int     `json:"requests"`
+	InputTokens         int     `json:"input_tokens"`
+	OutputTokens        int     `json:"output_tokens"`
+	CacheCreationTokens int     `json:"cache_creation_tokens"`
+	CacheReadTokens     int     `json:"cache_read_tokens"`
+	Cost                float64 `json:"cost_usd"`
+
+	// UnpricedRequests counts requests to models missing from the price
+	// table, whose cost is not included in Cost
+	UnpricedRequests int `json:"unpriced_requests,omitempty"`
+}
+
+// add includes a single request in the totals, charged at rate times the
+// listed price
+func (t *Totals) add(model string, u models.Usage, rate float64) {
+	t.Requests++
+	t.InputTokens += u.InputTokens
+	t.OutputTokens += u.OutputTokens
+	t.CacheCreationTokens += u.CacheCreationInputTokens
+	t.CacheReadTokens += u.CacheReadInputTokens
+	if cost, ok := Cost(model, u); ok {
+		t.Cost += cost * rate
+	} else {
+		t.UnpricedRequests++
+	}
+}
+
+// Since returns the usage added to the totals after they were earlier
+func (t Totals) Since(earlier Totals) Totals {
+	return Totals{
+		Requests:            t.Requests - earlier.Requests,
+		InputTokens:         t.InputTokens - earlier.InputTokens,
+		OutputTokens:        t.OutputTokens - earlier.OutputTokens,
+		CacheCreationTokens: t.CacheCreationTokens - earlier.CacheCreationTokens,
+		CacheReadTokens:     t.CacheReadTokens - earlier.CacheReadTokens,
+		Cost:                t.Cost - earlier.Cost,
+		UnpricedRequests:    t.UnpricedRequests - earlier.UnpricedRequests,
+	}
+}
+
+// Tokens returns the total number of tokens counted
+func (t Totals) Tokens() int {
+	return t.InputTokens + t.OutputTokens + t.CacheCreationTokens + t.CacheReadTokens
+}
+
+// CacheHitRate returns the fraction of input tokens that were read from the
+// prompt cache rather than processed afresh
+func (t Totals) CacheHitRate() float64 {
+	input := t.InputTokens + t.CacheCreationTokens + t.CacheReadTokens
+	if input == 0 {
+		return 0
+	}
+	return float64(t.CacheReadTokens) / float64(input)
+}
+
+// Day is the usage recorded on a single day, as persisted to disk
+type Day struct {
+	Date    string            `json:"date"`
+	Total   Totals            `json:"total"`
+	ByTask  map[string]Totals `json:"by_task"`
+	ByModel map[string]Totals `json:"by_model"`
+}
+
+// Tracker accounts for the tokens used during a session, broken down by task,
+// and keeps a running record of each day's usage on disk
+type Tracker struct {
+	mutex   sync.Mutex
+	dir     string
+	session Totals
+	byTask  map[string]Totals
+	byModel map[string]Totals
+	saveErr error
+}
+
+// NewTracker creates a tracker that persists daily totals under dir. An empty
+// dir keeps usage in memory only.
+func NewTracker(dir string) *Tracker {
+	return &Tracker{
+		dir:     dir,
+		byTask:  make(map[string]Totals),
+		byModel: make(map[string]Totals),
+	}
+}
+
+// Record accounts for a request made for a task
+func (t *Tracker) Record(task string, model string, u models.Usage) {
+	t.record(task, model, u, 1)
+}
+
+// RecordBatch accounts for a request made for a task through the Message
+// Batches API, which is charged at BatchRate of the usual price
+func (t *Tracker) RecordBatch(task string, model string, u models.Usage) {
+	t.record(task, model, u, BatchRate)
+}
+
+// record accounts for a request charged at rate times the listed price
+func (t *Tracker) record(task string, model string, u models.Usage, rate float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.session.add(model, u, rate)
+	addTo(t.byTask, task, model, u, rate)
+	addTo(t.byModel, model, model, u, rate)
+
+	t.saveErr = t.persist(time.Now(), task, model, u, rate)
+}
+
+// Session returns the totals for the session so far
+func (t *Tracker) Session() Totals {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.session
+}
+
+// ByTask returns the session totals for each task
+func (t *Tracker) ByTask() map[string]Totals {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	byTask := make(map[string]Totals, len(t.byTask))
+	for task, totals := range t.byTask {
+		byTask[task] = totals
+	}
+	return byTask
+}
+
+// LoadDay reads the usage persisted for the day containing date
+func (t *Tracker) LoadDay(date time.Time) (Day, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.loadDay(date)
+}
+
+// Report describes the session's usage by task, along with today's total
+func (t *Tracker) Report() string {
+	session := t.Session()
+	byTask := t.ByTask()
+
+	var b strings.Builder
+	b.WriteString("Token usage this session:\n\n")
+
+	if session.Requests == 0 {
+		b.WriteString("No requests made yet.\n")
+	} else {
+		tasks := make([]string, 0, len(byTask))
+		for task := range byTask {
+			tasks = append(tasks, task)
+		}
+		sort.Strings(tasks)
+
+		for _, task := range tasks {
+			b.WriteString(formatLine(task, byTask[task]))
+		}
+		b.WriteString(formatLine("total", session))
+	}
+
+	if t.dir != "" {
+		today, err := t.LoadDay(time.Now())
+		if err == nil && today.Total.Requests > 0 {
+			b.WriteString("\n")
+			b.WriteString(formatLine("today", today.Total))
+		}
+	}
+
+	t.mutex.Lock()
+	saveErr := t.saveErr
+	t.mutex.Unlock()
+	if saveErr != nil {
+		fmt.Fprintf(&b, "\nWarning: unable to save usage: %v\n", saveErr)
+	}
+
+	return b.String()
+}
+
+// Summary describes the session totals in a single short line
+func (t *Tracker) Summary() string {
+	session := t.Session()
+	summary := fmt.Sprintf("%s tokens · $%.4f", formatCount(session.Tokens()), session.Cost)
+	if session.CacheReadTokens > 0 {
+		summary += fmt.Sprintf(" · %.0f%% cached", session.CacheHitRate()*100)
+	}
+	return summary
+}
+
+// persist adds a request to the file for the day containing now
+func (t *Tracker) persist(now time.Time, task string, model string, u models.Usage, rate float64) error {
+	if t.dir == "" {
+		return nil
+	}
+
+	day, err := t.loadDay(now)
+	if err != nil {
+		return err
+	}
+
+	day.Total.add(model, u, rate)
+	addTo(day.ByTask, task, model, u, rate)
+	addTo(day.ByModel, model, model, u, rate)
+
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(day, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash cannot leave a partial record
+	path := t.dayPath(now)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// loadDay reads the file for the day containing date, if there is one
+func (t *Tracker) loadDay(date time.Time) (Day, error) {
+	day := Day{
+		Date:    date.Format("2006-01-02"),
+		ByTask:  make(map[string]Totals),
+		ByModel: make(map[string]Totals),
+	}
+	if t.dir == "" {
+		return day, nil
+	}
+
+	data, err := os.ReadFile(t.dayPath(date))
+	if os.IsNotExist(err) {
+		return day, nil
+	}
+	if err != nil {
+		return day, err
+	}
+
+	if err := json.Unmarshal(data, &day); err != nil {
+		return day, fmt.Errorf("invalid usage file for %s: %v", day.Date, err)
+	}
+	if day.ByTask == nil {
+		day.ByTask = make(map[string]Totals)
+	}
+	if day.ByModel == nil {
+		day.ByModel = make(map[string]Totals)
+	}
+	return day, nil
+}
+
+// dayPath returns the file holding the usage for the day containing date
+func (t *Tracker) dayPath(date time.Time) string {
+	return filepath.Join(t.dir, date.Format("2006-01-02")+".json")
+}
+
+// addTo includes a request in the totals held under key
+func addTo(totals map[string]Totals, key string, model string, u models.Usage, rate float64) {
+	entry := totals[key]
+	entry.add(model, u, rate)
+	totals[key] = entry
+}
+
+// formatLine formats one row of a usage report
+func formatLine(label string, totals Totals) string {
+	line := fmt.Sprintf("%-8s %4d requests  %9s in  %9s out", label, totals.Requests,
+		formatCount(totals.InputTokens), formatCount(totals.OutputTokens))
+	if totals.CacheCreationTokens+totals.CacheReadTokens > 0 {
+		line += fmt.Sprintf("  %9s cache hits (%.0f%%)  %9s cache writes", formatCount(totals.CacheReadTokens),
+			totals.CacheHitRate()*100, formatCount(totals.CacheCreationTokens))
+	}
+	line += fmt.Sprintf("  $%.4f", totals.Cost)
+	if totals.UnpricedRequests > 0 {
+		line += fmt.Sprintf(" (+%d unpriced)", totals.UnpricedRequests)
+	}
+	return line + "\n"
+}
+
+// formatCount formats a number with thousands separators
+func formatCount(n int) string {
+	digits := fmt.Sprintf("%d", n)
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}